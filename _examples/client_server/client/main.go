@@ -1,3 +1,4 @@
+//go:generate go run ../../.. -package=main -output=client.go -client-only ../example.xml
 package main
 
 import (
@@ -1,3 +1,4 @@
+//go:generate go run ../../.. -package=main -output=server.go -server-only ../example.xml
 package main
 
 import (
@@ -1,4 +1,4 @@
-//go:generate dbus-codegen-go -package=main -prefix=org.freedesktop.DBus -camelize -output=om.go -client-only om.xml
+//go:generate go run ../.. -package=main -prefix=org.freedesktop.DBus -camelize -output=om.go -client-only om.xml
 package main
 
 import (
@@ -41,65 +41,47 @@ func run(dest string) error {
 	}
 	defer conn.Close()
 
-	om := NewObjectManager(conn.Object(dest, pathFlag))
-	objects, err := om.GetManagedObjects(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	objects, err := GetManagedObjects(ctx, conn, dest, pathFlag)
 	if err != nil {
 		return err
 	}
-	for path, ifaces := range objects {
+	for path, object := range objects {
 		fmt.Println(path)
-		for iface := range ifaces {
+		for _, iface := range object.Interfaces {
 			fmt.Printf("  %s\n", iface)
 		}
 		fmt.Println()
 	}
 
-	sigc := make(chan *dbus.Signal, 1)
-	conn.Signal(sigc)
-	defer conn.RemoveSignal(sigc)
-	for _, sig := range []Signal{
-		(*ObjectManagerInterfacesAddedSignal)(nil),
-		(*ObjectManagerInterfacesRemovedSignal)(nil),
-	} {
-		if err = AddMatchSignal(conn, sig, dbus.WithMatchSender(dest)); err != nil {
-			return err
+	d := NewSignalDispatcher(conn)
+	defer d.Close()
+	if _, err = d.OnObjectManagerInterfacesAdded(func(sig *ObjectManagerInterfacesAddedSignal) {
+		fmt.Printf("%s NEW\n", sig.Body.Object)
+		for iface := range sig.Body.Interfaces {
+			fmt.Printf("  %s\n", iface)
 		}
+		fmt.Println()
+	}, WithWatchSender(dest), WithWatchPath(pathFlag)); err != nil {
+		return err
+	}
+	if _, err = d.OnObjectManagerInterfacesRemoved(func(sig *ObjectManagerInterfacesRemovedSignal) {
+		fmt.Printf("%s DEL\n", sig.Body.Object)
+		for _, iface := range sig.Body.Interfaces {
+			fmt.Printf("  %s\n", iface)
+		}
+		fmt.Println()
+	}, WithWatchSender(dest), WithWatchPath(pathFlag)); err != nil {
+		return err
 	}
 
 	ossigc := make(chan os.Signal, 1)
 	signal.Notify(ossigc, os.Interrupt)
-
-	for {
-		select {
-		case s := <-sigc:
-			v, err := LookupSignal(s)
-			if err != nil {
-				if err == ErrUnknownSignal {
-					continue
-				}
-			}
-
-			switch sig := v.(type) {
-			case *ObjectManagerInterfacesAddedSignal:
-				fmt.Printf("%s NEW\n", sig.Body.Object)
-				for iface := range sig.Body.Interfaces {
-					fmt.Printf("  %s\n", iface)
-				}
-				fmt.Println()
-			case *ObjectManagerInterfacesRemovedSignal:
-				fmt.Printf("%s DEL\n", sig.Body.Object)
-				for _, iface := range sig.Body.Interfaces {
-					fmt.Printf("  %s\n", iface)
-				}
-				fmt.Println()
-			default:
-				panic("should never get here")
-			}
-		case <-ossigc:
-			signal.Reset()
-			return nil
-		}
-	}
+	<-ossigc
+	signal.Reset()
+	return nil
 }
 
 func connect(system bool) (*dbus.Conn, error) {
@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/godbus/dbus/v5"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // Signal is a common interface for all signals.
@@ -26,12 +29,15 @@ var ErrUnknownSignal = errors.New("unknown signal")
 func LookupSignal(signal *dbus.Signal) (Signal, error) {
 	switch signal.Name {
 	case InterfaceObjectManager + "." + "InterfacesAdded":
-		v0, ok := signal.Body[0].(dbus.ObjectPath)
-		if !ok {
+		if len(signal.Body) < 2 {
+			return nil, fmt.Errorf("signal has %v args rather than the expected 2", len(signal.Body))
+		}
+		var v0 dbus.ObjectPath
+		if err := dbus.Store(signal.Body[0:0+1], &v0); err != nil {
 			return nil, fmt.Errorf("prop .Object is %T, not dbus.ObjectPath", signal.Body[0])
 		}
-		v1, ok := signal.Body[1].(map[string]map[string]dbus.Variant)
-		if !ok {
+		var v1 map[string]map[string]dbus.Variant
+		if err := dbus.Store(signal.Body[1:1+1], &v1); err != nil {
 			return nil, fmt.Errorf("prop .Interfaces is %T, not map[string]map[string]dbus.Variant", signal.Body[1])
 		}
 		return &ObjectManagerInterfacesAddedSignal{
@@ -43,12 +49,15 @@ func LookupSignal(signal *dbus.Signal) (Signal, error) {
 			},
 		}, nil
 	case InterfaceObjectManager + "." + "InterfacesRemoved":
-		v0, ok := signal.Body[0].(dbus.ObjectPath)
-		if !ok {
+		if len(signal.Body) < 2 {
+			return nil, fmt.Errorf("signal has %v args rather than the expected 2", len(signal.Body))
+		}
+		var v0 dbus.ObjectPath
+		if err := dbus.Store(signal.Body[0:0+1], &v0); err != nil {
 			return nil, fmt.Errorf("prop .Object is %T, not dbus.ObjectPath", signal.Body[0])
 		}
-		v1, ok := signal.Body[1].([]string)
-		if !ok {
+		var v1 []string
+		if err := dbus.Store(signal.Body[1:1+1], &v1); err != nil {
 			return nil, fmt.Errorf("prop .Interfaces is %T, not []string", signal.Body[1])
 		}
 		return &ObjectManagerInterfacesRemovedSignal{
@@ -81,6 +90,519 @@ func RemoveMatchSignal(conn *dbus.Conn, s Signal, opts ...dbus.MatchOption) erro
 	}, opts...)...)
 }
 
+// WatchOption is an option of signal Watch functions and SignalDispatcher handlers.
+type WatchOption func(w *watcher)
+
+// WithWatchPath receives signals emitted by the named object only.
+func WithWatchPath(path dbus.ObjectPath) WatchOption {
+	return func(w *watcher) {
+		w.path = path
+	}
+}
+
+// WithWatchPathNamespace receives signals emitted by
+// the named object and objects below it only.
+func WithWatchPathNamespace(namespace dbus.ObjectPath) WatchOption {
+	return func(w *watcher) {
+		w.namespace = namespace
+	}
+}
+
+// WithWatchSender receives signals emitted by the named sender only,
+// well-known names are tracked to match signals of their current owners.
+func WithWatchSender(sender string) WatchOption {
+	return func(w *watcher) {
+		w.sender = sender
+	}
+}
+
+// withWatchArg0 receives signals with the given first string argument only.
+func withWatchArg0(arg0 string) WatchOption {
+	return func(w *watcher) {
+		w.arg0 = arg0
+	}
+}
+
+// watcher is a signal subscription.
+type watcher struct {
+	name      string // interface and member names
+	arg0      string
+	path      dbus.ObjectPath
+	namespace dbus.ObjectPath
+	sender    string
+	owner     string // unique name of the sender
+
+	match      []dbus.MatchOption
+	ownerMatch []dbus.MatchOption
+}
+
+const busName = "org.freedesktop.DBus"
+
+func newWatcher(iface, member string, opts []WatchOption) *watcher {
+	w := &watcher{name: iface + "." + member}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.match = []dbus.MatchOption{
+		dbus.WithMatchInterface(iface),
+		dbus.WithMatchMember(member),
+	}
+	if w.path != "" {
+		w.match = append(w.match, dbus.WithMatchObjectPath(w.path))
+	}
+	if w.namespace != "" {
+		w.match = append(w.match, dbus.WithMatchPathNamespace(w.namespace))
+	}
+	if w.sender != "" {
+		w.match = append(w.match, dbus.WithMatchSender(w.sender))
+	}
+	if w.arg0 != "" {
+		w.match = append(w.match, dbus.WithMatchArg(0, w.arg0))
+	}
+	if w.sender != "" && w.sender != busName && !strings.HasPrefix(w.sender, ":") {
+		w.ownerMatch = []dbus.MatchOption{
+			dbus.WithMatchSender(busName),
+			dbus.WithMatchInterface(busName),
+			dbus.WithMatchMember("NameOwnerChanged"),
+			dbus.WithMatchArg(0, w.sender),
+		}
+	}
+	return w
+}
+
+// addMatch installs the watcher's match rules
+// and resolves the sender's current owner.
+func (w *watcher) addMatch(ctx context.Context, conn *dbus.Conn) error {
+	if err := conn.AddMatchSignal(w.match...); err != nil {
+		return err
+	}
+	if w.ownerMatch == nil {
+		return nil
+	}
+	if err := conn.AddMatchSignal(w.ownerMatch...); err != nil {
+		conn.RemoveMatchSignal(w.match...)
+		return err
+	}
+	if err := conn.BusObject().CallWithContext(
+		ctx, busName+".GetNameOwner", 0, w.sender,
+	).Store(&w.owner); err != nil {
+		if e, ok := err.(dbus.Error); !ok || e.Name != busName+".Error.NameHasNoOwner" {
+			w.removeMatch(conn)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMatch removes the watcher's match rules.
+func (w *watcher) removeMatch(conn *dbus.Conn) {
+	conn.RemoveMatchSignal(w.match...)
+	if w.ownerMatch != nil {
+		conn.RemoveMatchSignal(w.ownerMatch...)
+	}
+}
+
+// matches reports whether the signal satisfies the watcher's filters,
+// sender's owner changes are tracked along the way.
+func (w *watcher) matches(sig *dbus.Signal) bool {
+	if w.ownerMatch != nil && sig.Sender == busName &&
+		sig.Name == busName+".NameOwnerChanged" &&
+		len(sig.Body) == 3 && sig.Body[0] == w.sender {
+		w.owner, _ = sig.Body[2].(string)
+		return false
+	}
+	if sig.Name != w.name {
+		return false
+	}
+	if w.arg0 != "" && (len(sig.Body) == 0 || sig.Body[0] != w.arg0) {
+		return false
+	}
+	if w.path != "" && sig.Path != w.path {
+		return false
+	}
+	if w.namespace != "" && w.namespace != "/" && sig.Path != w.namespace &&
+		!strings.HasPrefix(string(sig.Path), string(w.namespace)+"/") {
+		return false
+	}
+	switch {
+	case w.sender == "":
+		return true
+	case w.owner != "":
+		return sig.Sender == w.owner
+	default:
+		return sig.Sender == w.sender
+	}
+}
+
+// watch installs the watcher's match rules and delivers matching signals
+// to the returned channel until ctx is done or conn is closed.
+func watch(ctx context.Context, conn *dbus.Conn, w *watcher) (<-chan *dbus.Signal, error) {
+	if err := w.addMatch(ctx, conn); err != nil {
+		return nil, err
+	}
+	sigc := make(chan *dbus.Signal, 16)
+	conn.Signal(sigc)
+	ch := make(chan *dbus.Signal)
+	go func() {
+		defer func() {
+			conn.RemoveSignal(sigc)
+			w.removeMatch(conn)
+			close(ch)
+		}()
+		for {
+			select {
+			case sig, ok := <-sigc:
+				if !ok {
+					return
+				}
+				if !w.matches(sig) {
+					continue
+				}
+				select {
+				case ch <- sig:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// SignalDispatcher consumes signals of a connection once
+// and routes them to handlers registered with On methods.
+type SignalDispatcher struct {
+	conn *dbus.Conn
+	sigc chan *dbus.Signal
+	stop chan struct{}
+	once sync.Once
+
+	mu       sync.Mutex
+	handlers []*signalHandler
+}
+
+type signalHandler struct {
+	w  *watcher
+	fn func(s Signal)
+}
+
+// NewSignalDispatcher creates a dispatcher of signals received by conn,
+// it has to be closed with Close when it's not needed anymore.
+func NewSignalDispatcher(conn *dbus.Conn) *SignalDispatcher {
+	d := &SignalDispatcher{
+		conn: conn,
+		sigc: make(chan *dbus.Signal, 16),
+		stop: make(chan struct{}),
+	}
+	conn.Signal(d.sigc)
+	go d.dispatch()
+	return d
+}
+
+// dispatch calls handlers matching received signals one by one
+// in order of registration, so handlers shouldn't block.
+func (d *SignalDispatcher) dispatch() {
+	for {
+		select {
+		case sig, ok := <-d.sigc:
+			if !ok {
+				return
+			}
+			var matched []*signalHandler
+			d.mu.Lock()
+			for _, h := range d.handlers {
+				if h.w.matches(sig) {
+					matched = append(matched, h)
+				}
+			}
+			d.mu.Unlock()
+			if len(matched) == 0 {
+				continue
+			}
+			typed, err := LookupSignal(sig)
+			if err != nil {
+				continue
+			}
+			for _, h := range matched {
+				h.fn(typed)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// subscribe registers a handler of signals of the same type as s
+// and returns a function that unregisters it.
+func (d *SignalDispatcher) subscribe(s Signal, opts []WatchOption, fn func(s Signal)) (func(), error) {
+	h := &signalHandler{w: newWatcher(s.Interface(), s.Name(), opts), fn: fn}
+	if err := h.w.addMatch(context.Background(), d.conn); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.handlers = append(d.handlers, h)
+	d.mu.Unlock()
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for i := range d.handlers {
+			if d.handlers[i] == h {
+				d.handlers = append(d.handlers[:i], d.handlers[i+1:]...)
+				h.w.removeMatch(d.conn)
+				return
+			}
+		}
+	}, nil
+}
+
+// Close unregisters all handlers and stops dispatching signals.
+func (d *SignalDispatcher) Close() error {
+	d.once.Do(func() {
+		close(d.stop)
+		d.conn.RemoveSignal(d.sigc)
+		d.mu.Lock()
+		for _, h := range d.handlers {
+			h.w.removeMatch(d.conn)
+		}
+		d.handlers = nil
+		d.mu.Unlock()
+	})
+	return nil
+}
+
+// ManagedObject is an object exported by an org.freedesktop.DBus.ObjectManager
+// with typed proxies and properties snapshots of implemented interfaces,
+// fields of interfaces not implemented by the object are nil.
+type ManagedObject struct {
+	Path dbus.ObjectPath
+
+	// Interfaces lists names of all implemented interfaces
+	// including ones that don't have generated code.
+	Interfaces []string
+
+	ObjectManager *ObjectManager
+}
+
+// Implements reports whether the object implements the named interface.
+func (o *ManagedObject) Implements(iface string) bool {
+	i := sort.SearchStrings(o.Interfaces, iface)
+	return i < len(o.Interfaces) && o.Interfaces[i] == iface
+}
+
+// withInterfaces returns a copy of the object with the given interfaces added.
+func (o *ManagedObject) withInterfaces(obj dbus.BusObject, ifaces map[string]map[string]dbus.Variant) (*ManagedObject, error) {
+	c := *o
+	c.Interfaces = make([]string, len(o.Interfaces), len(o.Interfaces)+len(ifaces))
+	copy(c.Interfaces, o.Interfaces)
+	for iface, _ := range ifaces {
+		if !o.Implements(iface) {
+			c.Interfaces = append(c.Interfaces, iface)
+		}
+		switch iface {
+		case InterfaceObjectManager:
+			c.ObjectManager = NewObjectManager(obj)
+		}
+	}
+	sort.Strings(c.Interfaces)
+	return &c, nil
+}
+
+// withoutInterfaces returns a copy of the object with the given interfaces removed.
+func (o *ManagedObject) withoutInterfaces(ifaces []string) *ManagedObject {
+	c := *o
+	c.Interfaces = make([]string, 0, len(o.Interfaces))
+	for _, iface := range o.Interfaces {
+		var found bool
+		for i := range ifaces {
+			if ifaces[i] == iface {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.Interfaces = append(c.Interfaces, iface)
+		}
+	}
+	for _, iface := range ifaces {
+		switch iface {
+		case InterfaceObjectManager:
+			c.ObjectManager = nil
+		}
+	}
+	return &c
+}
+
+// GetManagedObjects returns all objects exported by
+// the named org.freedesktop.DBus.ObjectManager object.
+func GetManagedObjects(ctx context.Context, conn *dbus.Conn, dest string, path dbus.ObjectPath) (map[dbus.ObjectPath]*ManagedObject, error) {
+	call := conn.Object(dest, path).CallWithContext(
+		ctx, "org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0,
+	)
+	if call.Err != nil {
+		return nil, call.Err
+	}
+	// type assertion instead of storing keeps variants signatures intact
+	var raw map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	if len(call.Body) != 0 {
+		raw, _ = call.Body[0].(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	}
+	if raw == nil {
+		return nil, errors.New("GetManagedObjects reply has unexpected signature")
+	}
+	objects := make(map[dbus.ObjectPath]*ManagedObject, len(raw))
+	for path, ifaces := range raw {
+		o, err := (&ManagedObject{Path: path}).withInterfaces(conn.Object(dest, path), ifaces)
+		if err != nil {
+			return nil, err
+		}
+		objects[path] = o
+	}
+	return objects, nil
+}
+
+// ObjectCache is a live cache of objects exported by an
+// org.freedesktop.DBus.ObjectManager object kept up to date by
+// tracking its InterfacesAdded and InterfacesRemoved signals.
+//
+// Cached objects are never modified, changes replace them with new ones.
+type ObjectCache struct {
+	conn    *dbus.Conn
+	dest    string
+	added   *watcher
+	removed *watcher
+	sigc    chan *dbus.Signal
+	stop    chan struct{}
+	once    sync.Once
+
+	mu      sync.RWMutex
+	objects map[dbus.ObjectPath]*ManagedObject
+}
+
+// NewObjectCache loads objects exported by the named object manager
+// and starts tracking their changes, the cache has to be closed with
+// Close when it's not needed anymore.
+func NewObjectCache(ctx context.Context, conn *dbus.Conn, dest string, path dbus.ObjectPath) (*ObjectCache, error) {
+	c := &ObjectCache{
+		conn: conn,
+		dest: dest,
+		added: newWatcher("org.freedesktop.DBus.ObjectManager", "InterfacesAdded", []WatchOption{
+			WithWatchSender(dest), WithWatchPath(path),
+		}),
+		removed: newWatcher("org.freedesktop.DBus.ObjectManager", "InterfacesRemoved", []WatchOption{
+			WithWatchSender(dest), WithWatchPath(path),
+		}),
+		sigc: make(chan *dbus.Signal, 16),
+		stop: make(chan struct{}),
+	}
+	if err := c.added.addMatch(ctx, conn); err != nil {
+		return nil, err
+	}
+	if err := c.removed.addMatch(ctx, conn); err != nil {
+		c.added.removeMatch(conn)
+		return nil, err
+	}
+
+	// subscribe before loading objects to not miss changes
+	conn.Signal(c.sigc)
+	objects, err := GetManagedObjects(ctx, conn, dest, path)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.objects = objects
+	go c.track()
+	return c, nil
+}
+
+// track applies changes to cached objects, signals that
+// cannot be decoded are skipped.
+func (c *ObjectCache) track() {
+	for {
+		select {
+		case sig, ok := <-c.sigc:
+			if !ok {
+				return
+			}
+			var path dbus.ObjectPath
+			switch {
+			case c.added.matches(sig):
+				if len(sig.Body) != 2 {
+					continue
+				}
+				path, _ = sig.Body[0].(dbus.ObjectPath)
+				ifaces, ok := sig.Body[1].(map[string]map[string]dbus.Variant)
+				if !ok {
+					continue
+				}
+				c.mu.RLock()
+				o, ok := c.objects[path]
+				c.mu.RUnlock()
+				if !ok {
+					o = &ManagedObject{Path: path}
+				}
+				o, err := o.withInterfaces(c.conn.Object(c.dest, path), ifaces)
+				if err != nil {
+					continue
+				}
+				c.mu.Lock()
+				c.objects[path] = o
+				c.mu.Unlock()
+			case c.removed.matches(sig):
+				var ifaces []string
+				if err := dbus.Store(sig.Body, &path, &ifaces); err != nil {
+					continue
+				}
+				c.mu.Lock()
+				if o, ok := c.objects[path]; ok {
+					if o = o.withoutInterfaces(ifaces); len(o.Interfaces) == 0 {
+						delete(c.objects, path)
+					} else {
+						c.objects[path] = o
+					}
+				}
+				c.mu.Unlock()
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Object returns the cached object with the given path.
+func (c *ObjectCache) Object(path dbus.ObjectPath) (*ManagedObject, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	o, ok := c.objects[path]
+	return o, ok
+}
+
+// Objects returns all cached objects sorted by path.
+func (c *ObjectCache) Objects() []*ManagedObject {
+	c.mu.RLock()
+	objects := make([]*ManagedObject, 0, len(c.objects))
+	for _, o := range c.objects {
+		objects = append(objects, o)
+	}
+	c.mu.RUnlock()
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Path < objects[j].Path
+	})
+	return objects
+}
+
+// Close stops tracking changes of the cached objects.
+func (c *ObjectCache) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+		c.conn.RemoveSignal(c.sigc)
+		c.added.removeMatch(c.conn)
+		c.removed.removeMatch(c.conn)
+	})
+	return nil
+}
+
 // Interface name constants.
 const (
 	InterfaceObjectManager = "org.freedesktop.DBus.ObjectManager"
@@ -138,6 +660,47 @@ type ObjectManagerInterfacesAddedSignalBody struct {
 	Interfaces map[string]map[string]dbus.Variant
 }
 
+// WatchObjectManagerInterfacesAdded subscribes to org.freedesktop.DBus.ObjectManager.InterfacesAdded signal,
+// the returned channel is closed when ctx is done or conn is closed,
+// signals that cannot be decoded are skipped.
+func WatchObjectManagerInterfacesAdded(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *ObjectManagerInterfacesAddedSignal, error) {
+	sigc, err := watch(ctx, conn, newWatcher(InterfaceObjectManager, "InterfacesAdded", opts))
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *ObjectManagerInterfacesAddedSignal)
+	go func() {
+		defer close(ch)
+		for sig := range sigc {
+			s, err := LookupSignal(sig)
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- s.(*ObjectManagerInterfacesAddedSignal):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// WatchInterfacesAdded subscribes to org.freedesktop.DBus.ObjectManager.InterfacesAdded signal emitted by the object,
+// see WatchObjectManagerInterfacesAdded, conn has to be the connection the object belongs to.
+func (o *ObjectManager) WatchInterfacesAdded(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *ObjectManagerInterfacesAddedSignal, error) {
+	return WatchObjectManagerInterfacesAdded(ctx, conn, append([]WatchOption{
+		WithWatchSender(o.object.Destination()), WithWatchPath(o.object.Path()),
+	}, opts...)...)
+}
+
+// OnObjectManagerInterfacesAdded registers a handler of org.freedesktop.DBus.ObjectManager.InterfacesAdded signal,
+// it's called until the returned function is called or d is closed.
+func (d *SignalDispatcher) OnObjectManagerInterfacesAdded(fn func(s *ObjectManagerInterfacesAddedSignal), opts ...WatchOption) (unsubscribe func(), err error) {
+	return d.subscribe(&ObjectManagerInterfacesAddedSignal{}, opts, func(s Signal) {
+		fn(s.(*ObjectManagerInterfacesAddedSignal))
+	})
+}
+
 // ObjectManagerInterfacesRemovedSignal represents org.freedesktop.DBus.ObjectManager.InterfacesRemoved signal.
 type ObjectManagerInterfacesRemovedSignal struct {
 	sender string
@@ -173,3 +736,44 @@ type ObjectManagerInterfacesRemovedSignalBody struct {
 	Object     dbus.ObjectPath
 	Interfaces []string
 }
+
+// WatchObjectManagerInterfacesRemoved subscribes to org.freedesktop.DBus.ObjectManager.InterfacesRemoved signal,
+// the returned channel is closed when ctx is done or conn is closed,
+// signals that cannot be decoded are skipped.
+func WatchObjectManagerInterfacesRemoved(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *ObjectManagerInterfacesRemovedSignal, error) {
+	sigc, err := watch(ctx, conn, newWatcher(InterfaceObjectManager, "InterfacesRemoved", opts))
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *ObjectManagerInterfacesRemovedSignal)
+	go func() {
+		defer close(ch)
+		for sig := range sigc {
+			s, err := LookupSignal(sig)
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- s.(*ObjectManagerInterfacesRemovedSignal):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// WatchInterfacesRemoved subscribes to org.freedesktop.DBus.ObjectManager.InterfacesRemoved signal emitted by the object,
+// see WatchObjectManagerInterfacesRemoved, conn has to be the connection the object belongs to.
+func (o *ObjectManager) WatchInterfacesRemoved(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *ObjectManagerInterfacesRemovedSignal, error) {
+	return WatchObjectManagerInterfacesRemoved(ctx, conn, append([]WatchOption{
+		WithWatchSender(o.object.Destination()), WithWatchPath(o.object.Path()),
+	}, opts...)...)
+}
+
+// OnObjectManagerInterfacesRemoved registers a handler of org.freedesktop.DBus.ObjectManager.InterfacesRemoved signal,
+// it's called until the returned function is called or d is closed.
+func (d *SignalDispatcher) OnObjectManagerInterfacesRemoved(fn func(s *ObjectManagerInterfacesRemovedSignal), opts ...WatchOption) (unsubscribe func(), err error) {
+	return d.subscribe(&ObjectManagerInterfacesRemovedSignal{}, opts, func(s Signal) {
+		fn(s.(*ObjectManagerInterfacesRemovedSignal))
+	})
+}
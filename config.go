@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/amenzhinsky/dbus-codegen-go/printer"
+)
+
+// target is a single code generation unit, the configuration file
+// either describes one target at the top level or lists them in the
+// "targets" array, top level values are defaults for all of them:
+//
+//	{
+//		"package": "systemd",
+//		"camelize": true,
+//		"prefixes": ["org.freedesktop.systemd1"],
+//		"targets": [
+//			{
+//				"inputs": ["org.freedesktop.systemd1.xml"],
+//				"only": ["org.freedesktop.systemd1.Manager"],
+//				"names": {"org.freedesktop.systemd1.Manager": "Manager"},
+//				"output": "systemd/manager.go"
+//			}
+//		]
+//	}
+type target struct {
+	Inputs        []string            `json:"inputs"`
+	Dest          []string            `json:"dest"`
+	System        bool                `json:"system"`
+	Only          []string            `json:"only"`
+	Except        []string            `json:"except"`
+	Prefixes      []string            `json:"prefixes"`
+	Package       string              `json:"package"`
+	Gofmt         bool                `json:"gofmt"`
+	Output        string              `json:"output"`
+	OutputDir     string              `json:"output_dir"`
+	ServerOnly    bool                `json:"server_only"`
+	ClientOnly    bool                `json:"client_only"`
+	Camelize      bool                `json:"camelize"`
+	Idiomatic     bool                `json:"idiomatic"`
+	Initialisms   []string            `json:"initialisms"`
+	Fakes         bool                `json:"fakes"`
+	ServerContext bool                `json:"server_context"`
+	Strict        bool                `json:"strict"`
+	Names         map[string]string   `json:"names"`
+	StructFields  map[string][]string `json:"struct_fields"`
+
+	// mappings are objects with type, decode and encode keys
+	Types map[string]*printer.TypeMapping `json:"types"`
+}
+
+type config struct {
+	target
+	Targets []json.RawMessage `json:"targets"`
+}
+
+// loadConfig reads the named configuration file, relative paths
+// in it are resolved against the file's directory.
+func loadConfig(filename string) ([]*target, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg := config{
+		target: target{
+			Package: "dbusgen",
+			Gofmt:   true,
+		},
+	}
+	if err = decodeJSON(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(cfg.Targets) == 0 {
+		cfg.Targets = []json.RawMessage{[]byte("{}")}
+	}
+
+	dir := filepath.Dir(filename)
+	targets := make([]*target, len(cfg.Targets))
+	for i, raw := range cfg.Targets {
+		// fields present in raw are overwritten, maps are merged
+		t := cfg.target
+		t.Names = copyNames(cfg.Names)
+		t.StructFields = copyStructFields(cfg.StructFields)
+		t.Types = copyTypes(cfg.Types)
+		if err = decodeJSON(raw, &t); err != nil {
+			return nil, fmt.Errorf("%s: targets[%d]: %w", filename, i, err)
+		}
+		if len(t.Inputs) == 0 && len(t.Dest) == 0 {
+			return nil, fmt.Errorf("%s: targets[%d]: neither inputs nor dest given", filename, i)
+		}
+		t.Inputs = resolvePaths(dir, t.Inputs)
+		if t.Output != "" {
+			t.Output = resolvePaths(dir, []string{t.Output})[0]
+		}
+		if t.OutputDir != "" {
+			t.OutputDir = resolvePaths(dir, []string{t.OutputDir})[0]
+		}
+		targets[i] = &t
+	}
+	return targets, nil
+}
+
+// decodeJSON is json.Unmarshal that rejects unknown keys,
+// so misspelled options aren't silently ignored.
+func decodeJSON(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level value")
+	}
+	return nil
+}
+
+func copyNames(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyStructFields(m map[string][]string) map[string][]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string][]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyTypes(m map[string]*printer.TypeMapping) map[string]*printer.TypeMapping {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]*printer.TypeMapping, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func resolvePaths(dir string, paths []string) []string {
+	resolved := make([]string, len(paths))
+	for i := range paths {
+		if filepath.IsAbs(paths[i]) {
+			resolved[i] = paths[i]
+		} else {
+			resolved[i] = filepath.Join(dir, paths[i])
+		}
+	}
+	return resolved
+}
+
+// applyFlags overrides the target's values with options explicitly
+// set in fs and its positional arguments, it stops at the first error.
+func (t *target) applyFlags(fs *flag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch f.Name {
+		case "dest":
+			t.Dest = destFlag
+		case "system":
+			t.System = systemFlag
+		case "only":
+			t.Only, t.Except = onlyFlag, exceptFlag
+		case "except":
+			t.Except, t.Only = exceptFlag, onlyFlag
+		case "prefix":
+			t.Prefixes = prefixFlag
+		case "package":
+			t.Package = packageFlag
+		case "gofmt":
+			t.Gofmt = gofmtFlag
+		case "output":
+			t.Output, t.OutputDir = outputFlag, outputDirFlag
+		case "output-dir":
+			t.OutputDir, t.Output = outputDirFlag, outputFlag
+		case "server-only":
+			t.ServerOnly = serverOnlyFlag
+			if serverOnlyFlag {
+				t.ClientOnly = clientOnlyFlag
+			}
+		case "client-only":
+			t.ClientOnly = clientOnlyFlag
+			if clientOnlyFlag {
+				t.ServerOnly = serverOnlyFlag
+			}
+		case "camelize":
+			t.Camelize = camelizeFlag
+		case "idiomatic":
+			t.Idiomatic = idiomaticFlag
+		case "initialism":
+			t.Initialisms = initialismFlag
+		case "name":
+			// merged into the configured names
+			if t.Names == nil {
+				t.Names = map[string]string{}
+			}
+			for _, kv := range nameFlag {
+				i := strings.IndexByte(kv, '=')
+				if i == -1 {
+					err = fmt.Errorf("-name %q: want name=GoName", kv)
+					return
+				}
+				t.Names[kv[:i]] = kv[i+1:]
+			}
+		case "type":
+			// merged into the configured types, an empty value disables the mapping
+			if t.Types == nil {
+				t.Types = map[string]*printer.TypeMapping{}
+			}
+			for _, kv := range typeFlag {
+				i := strings.IndexByte(kv, '=')
+				if i == -1 {
+					err = fmt.Errorf("-type %q: want key=Type,Decode,Encode", kv)
+					return
+				}
+				if kv[i+1:] == "" {
+					t.Types[kv[:i]] = nil
+					continue
+				}
+				parts := strings.Split(kv[i+1:], ",")
+				if len(parts) != 3 {
+					err = fmt.Errorf("-type %q: want key=Type,Decode,Encode", kv)
+					return
+				}
+				t.Types[kv[:i]] = &printer.TypeMapping{
+					Type:   parts[0],
+					Decode: parts[1],
+					Encode: parts[2],
+				}
+			}
+		case "fakes":
+			t.Fakes = fakesFlag
+		case "server-context":
+			t.ServerContext = contextFlag
+		case "strict":
+			t.Strict = strictFlag
+		case "struct-fields":
+			var b []byte
+			if b, err = os.ReadFile(fieldsFlag); err != nil {
+				return
+			}
+			t.StructFields = nil
+			if err = json.Unmarshal(b, &t.StructFields); err != nil {
+				err = fmt.Errorf("%s: %w", fieldsFlag, err)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		t.Inputs, t.Dest = fs.Args(), nil
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/amenzhinsky/dbus-codegen-go/printer"
+)
+
+// parseFlags resets option values and parses args with a fresh flag set.
+func parseFlags(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+	destFlag, onlyFlag, exceptFlag, prefixFlag = nil, nil, nil, nil
+	initialismFlag, nameFlag, typeFlag = nil, nil, nil
+	fs := flag.NewFlagSet("dbus-codegen-go", flag.ContinueOnError)
+	defineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	fields := filepath.Join(dir, "fields.json")
+	if err := os.WriteFile(fields, []byte(`{"(ss)": ["Name", "Value"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, test := range map[string]struct {
+		config string
+		args   []string
+		want   []*target
+	}{
+		"defaults": {
+			config: `{"inputs": ["foo.xml"]}`,
+			want: []*target{
+				{Inputs: []string{filepath.Join(dir, "foo.xml")}, Package: "dbusgen", Gofmt: true},
+			},
+		},
+		"targets": {
+			config: `{
+				"package": "systemd",
+				"camelize": true,
+				"names": {"org.example.Foo": "Foo"},
+				"targets": [
+					{"inputs": ["foo.xml"], "names": {"org.example.Bar": "Bar"}},
+					{"dest": ["org.example"], "package": "example", "camelize": false, "output": "out/example.go"}
+				]
+			}`,
+			want: []*target{
+				{
+					Inputs:   []string{filepath.Join(dir, "foo.xml")},
+					Package:  "systemd",
+					Gofmt:    true,
+					Camelize: true,
+					Names:    map[string]string{"org.example.Foo": "Foo", "org.example.Bar": "Bar"},
+				},
+				{
+					Inputs:  []string{},
+					Dest:    []string{"org.example"},
+					Package: "example",
+					Gofmt:   true,
+					Output:  filepath.Join(dir, "out", "example.go"),
+					Names:   map[string]string{"org.example.Foo": "Foo"},
+				},
+			},
+		},
+		"flags": {
+			config: `{
+				"inputs": ["foo.xml"],
+				"package": "systemd",
+				"camelize": true,
+				"except": ["org.example.Bar"],
+				"names": {"org.example.Foo": "Foo"},
+				"types": {"t": {"type": "time.Time", "decode": "a", "encode": "b"}},
+				"struct_fields": {"(ii)": ["X", "Y"]}
+			}`,
+			args: []string{
+				"-package=foo", "-camelize=false", "-only=org.example.Foo",
+				"-name=org.example.Foo.Bar=Baz", "-type=t=", "-type=s=net.IP,c,d",
+				"-struct-fields=" + fields, "bar.xml",
+			},
+			want: []*target{
+				{
+					Inputs:  []string{"bar.xml"},
+					Only:    []string{"org.example.Foo"},
+					Package: "foo",
+					Gofmt:   true,
+					Names:   map[string]string{"org.example.Foo": "Foo", "org.example.Foo.Bar": "Baz"},
+					Types: map[string]*printer.TypeMapping{
+						"t": nil,
+						"s": {Type: "net.IP", Decode: "c", Encode: "d"},
+					},
+					StructFields: map[string][]string{"(ss)": {"Name", "Value"}},
+				},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, "config.json")
+			if err := os.WriteFile(filename, []byte(test.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fs := parseFlags(t, test.args...)
+			targets, err := loadConfig(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, target := range targets {
+				if err = target.applyFlags(fs); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(targets, test.want) {
+				for i := range targets {
+					t.Logf("have[%d] = %+v", i, targets[i])
+				}
+				for i := range test.want {
+					t.Logf("want[%d] = %+v", i, test.want[i])
+				}
+				t.Error("targets don't match")
+			}
+		})
+	}
+}
+
+func TestLoadConfigError(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.json")
+	for name, test := range map[string]struct {
+		config string
+		args   []string
+		error  string
+	}{
+		"unknown key": {
+			config: `{"inputs": ["foo.xml"], "strcut_fields": {}}`,
+			error:  filename + `: json: unknown field "strcut_fields"`,
+		},
+		"unknown target key": {
+			config: `{"targets": [{"inputs": ["foo.xml"], "ouptut": "foo.go"}]}`,
+			error:  filename + `: targets[0]: json: unknown field "ouptut"`,
+		},
+		"trailing data": {
+			config: `{"inputs": ["foo.xml"]} {}`,
+			error:  filename + `: invalid data after top-level value`,
+		},
+		"no inputs": {
+			config: `{"targets": [{"inputs": ["foo.xml"]}, {"package": "foo"}]}`,
+			error:  filename + `: targets[1]: neither inputs nor dest given`,
+		},
+		"name": {
+			config: `{"inputs": ["foo.xml"]}`,
+			// -struct-fields is visited later and must not reset the error
+			args:  []string{"-name=org.example.Foo", "-struct-fields=" + filename},
+			error: `-name "org.example.Foo": want name=GoName`,
+		},
+		"type": {
+			config: `{"inputs": ["foo.xml"]}`,
+			args:   []string{"-type=t=time.Time"},
+			error:  `-type "t=time.Time": want key=Type,Decode,Encode`,
+		},
+		"struct fields": {
+			config: `{"inputs": ["foo.xml"]}`,
+			args:   []string{"-struct-fields=" + filepath.Join(dir, "missing.json")},
+			error:  "open " + filepath.Join(dir, "missing.json") + ": no such file or directory",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(filename, []byte(test.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fs := parseFlags(t, test.args...)
+			targets, err := loadConfig(filename)
+			if err == nil {
+				err = targets[0].applyFlags(fs)
+			}
+			if err == nil || err.Error() != test.error {
+				t.Errorf("error = %v, want %q", err, test.error)
+			}
+		})
+	}
+}
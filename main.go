@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/amenzhinsky/dbus-codegen-go/parser"
@@ -30,6 +31,16 @@ var (
 	serverOnlyFlag bool
 	clientOnlyFlag bool
 	camelizeFlag   bool
+	idiomaticFlag  bool
+	initialismFlag []string
+	nameFlag       []string
+	typeFlag       []string
+	fakesFlag      bool
+	contextFlag    bool
+	strictFlag     bool
+	fieldsFlag     string
+	configFlag     string
+	outputDirFlag  string
 )
 
 func main() {
@@ -42,70 +53,129 @@ Options:
 `)
 		flag.PrintDefaults()
 	}
-	flag.Var((*stringsVar)(&destFlag), "dest", "`destination` name(s) to introspect")
-	flag.Var((*stringsVar)(&onlyFlag), "only", "generate code only for the named `interface`s")
-	flag.Var((*stringsVar)(&exceptFlag), "except", "skip the named `interface`s")
-	flag.Var((*stringsVar)(&prefixFlag), "prefix", "`prefix` to strip from interface names")
-	flag.BoolVar(&systemFlag, "system", false, "connect to the system bus")
-	flag.StringVar(&packageFlag, "package", "dbusgen", "generated package `name`")
-	flag.BoolVar(&gofmtFlag, "gofmt", true, "gofmt results")
-	flag.BoolVar(&xmlFlag, "xml", false, "combine the dest's introspections into a single document")
-	flag.StringVar(&outputFlag, "output", "", "`path` to output destination")
-	flag.BoolVar(&serverOnlyFlag, "server-only", false, "generate only server-side code")
-	flag.BoolVar(&clientOnlyFlag, "client-only", false, "generate only client-side code")
-	flag.BoolVar(&camelizeFlag, "camelize", false, "camelize type names omitting underscores")
+	defineFlags(flag.CommandLine)
 	flag.Parse()
 
 	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		printError(err)
 		os.Exit(1)
 	}
 }
 
+// defineFlags registers command-line options in fs.
+func defineFlags(fs *flag.FlagSet) {
+	fs.Var((*stringsVar)(&destFlag), "dest", "`destination` name(s) to introspect")
+	fs.Var((*stringsVar)(&onlyFlag), "only", "generate code only for the named `interface`s")
+	fs.Var((*stringsVar)(&exceptFlag), "except", "skip the named `interface`s")
+	fs.Var((*stringsVar)(&prefixFlag), "prefix", "`prefix` to strip from interface names")
+	fs.BoolVar(&systemFlag, "system", false, "connect to the system bus")
+	fs.StringVar(&packageFlag, "package", "dbusgen", "generated package `name`")
+	fs.BoolVar(&gofmtFlag, "gofmt", true, "gofmt results")
+	fs.BoolVar(&xmlFlag, "xml", false, "combine the dest's introspections into a single document")
+	fs.StringVar(&outputFlag, "output", "", "`path` to output destination")
+	fs.StringVar(&outputDirFlag, "output-dir", "", "`directory` to write one file per interface to")
+	fs.BoolVar(&serverOnlyFlag, "server-only", false, "generate only server-side code")
+	fs.BoolVar(&clientOnlyFlag, "client-only", false, "generate only client-side code")
+	fs.BoolVar(&camelizeFlag, "camelize", false, "camelize type names omitting underscores")
+	fs.BoolVar(&idiomaticFlag, "idiomatic", false, "follow Go naming conventions, implies -camelize")
+	fs.Var((*stringsVar)(&initialismFlag), "initialism", "additional `initialism`s spelled as given in idiomatic names, e.g. GPU")
+	fs.Var((*stringsVar)(&nameFlag), "name", "`name=GoName` overriding the Go name of an interface, member or argument")
+	fs.Var((*listVar)(&typeFlag), "type", "`key=Type,Decode,Encode` mapping a signature or a property or an argument to a Go type")
+	fs.BoolVar(&fakesFlag, "fakes", false, "generate client interfaces and their in-memory fakes")
+	fs.BoolVar(&contextFlag, "server-context", false, "pass a context carrying the call's info to server methods")
+	fs.BoolVar(&strictFlag, "strict", false, "refuse to generate code for signatures violating the D-Bus specification")
+	fs.StringVar(&fieldsFlag, "struct-fields", "", "`path` to JSON file mapping struct signatures to field names")
+	fs.StringVar(&configFlag, "config", "", "`path` to JSON configuration file, options override its values")
+}
+
+// printError prints the given error to stderr, signature errors are
+// supplemented with the signature itself and a pointer to the error.
+func printError(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	var serr *parser.SignatureError
+	if errors.As(err, &serr) {
+		fmt.Fprintf(os.Stderr, "\t%s\n\t%s^\n",
+			serr.Signature, strings.Repeat(" ", serr.Offset))
+	}
+}
+
 func run() error {
-	if len(destFlag) == 0 && xmlFlag {
+	if configFlag == "" {
+		t := &target{
+			Package: packageFlag,
+			Gofmt:   gofmtFlag,
+		}
+		if err := t.applyFlags(flag.CommandLine); err != nil {
+			return err
+		}
+		return t.run()
+	}
+
+	targets, err := loadConfig(configFlag)
+	if err != nil {
+		return err
+	}
+	if len(targets) > 1 && (outputFlag != "" || outputDirFlag != "" || flag.NArg() > 0) {
+		return errors.New("cannot override output or file paths of multiple targets")
+	}
+	for _, t := range targets {
+		if err = t.applyFlags(flag.CommandLine); err != nil {
+			return err
+		}
+		if err = t.run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *target) run() error {
+	if len(t.Dest) == 0 && xmlFlag {
 		return errors.New("cannot combine -xml and -dest")
 	}
-	if serverOnlyFlag && clientOnlyFlag {
+	if t.ServerOnly && t.ClientOnly {
 		return errors.New("cannot combine -server-only and -client-only")
 	}
-	if len(onlyFlag) != 0 && len(exceptFlag) != 0 {
+	if len(t.Only) != 0 && len(t.Except) != 0 {
 		return errors.New("cannot combine -only and -except")
 	}
+	if t.Output != "" && t.OutputDir != "" {
+		return errors.New("cannot combine -output and -output-dir")
+	}
 
 	var ifaces []*token.Interface
 	switch {
-	case len(destFlag) != 0:
-		if flag.NArg() > 0 {
+	case len(t.Dest) != 0:
+		if len(t.Inputs) > 0 {
 			return errors.New("cannot combine -dest and file paths")
 		}
-		conn, err := connect(systemFlag)
+		conn, err := connect(t.System)
 		if err != nil {
 			return err
 		}
 		defer conn.Close()
 
 		if xmlFlag {
-			b, err := generateXML(conn, destFlag)
+			b, err := generateXML(conn, t.Dest, t.isNeeded)
 			if err != nil {
 				return err
 			}
 			fmt.Println(string(b))
 			return nil
 		}
-		ifaces, err = parseDest(conn, destFlag)
+		ifaces, err = parseDest(conn, t.Dest, t.Strict)
 		if err != nil {
 			return err
 		}
-	case flag.NArg() > 0:
-		for _, filename := range flag.Args() {
+	case len(t.Inputs) > 0:
+		for _, filename := range t.Inputs {
 			b, err := os.ReadFile(filename)
 			if err != nil {
 				return err
 			}
-			chunk, err := parser.Parse(b)
+			chunk, err := parser.Parse(b, parser.WithStrict(t.Strict))
 			if err != nil {
-				return err
+				return fmt.Errorf("%s: %w", filename, err)
 			}
 			ifaces = merge(ifaces, chunk)
 		}
@@ -114,7 +184,7 @@ func run() error {
 		if err != nil {
 			return err
 		}
-		ifaces, err = parser.Parse(b)
+		ifaces, err = parser.Parse(b, parser.WithStrict(t.Strict))
 		if err != nil {
 			return err
 		}
@@ -122,26 +192,50 @@ func run() error {
 
 	filtered := make([]*token.Interface, 0, len(ifaces))
 	for _, iface := range ifaces {
-		if isNeeded(iface.Name) {
+		if t.isNeeded(iface.Name) {
 			filtered = append(filtered, iface)
 		}
 	}
 
+	opts := []printer.PrintOption{
+		printer.WithPackageName(t.Package),
+		printer.WithGofmt(t.Gofmt),
+		printer.WithPrefixes(t.Prefixes),
+		printer.WithServerOnly(t.ServerOnly),
+		printer.WithClientOnly(t.ClientOnly),
+		printer.WithCamelize(t.Camelize),
+		printer.WithIdiomatic(t.Idiomatic),
+		printer.WithInitialisms(t.Initialisms),
+		printer.WithFakes(t.Fakes),
+		printer.WithServerContext(t.ServerContext),
+		printer.WithStructFields(t.StructFields),
+		printer.WithNames(t.Names),
+		printer.WithTypes(t.Types),
+	}
+	if t.OutputDir != "" {
+		files, err := printer.PrintFiles(filtered, opts...)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(t.OutputDir, 0755); err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err = os.WriteFile(filepath.Join(t.OutputDir, f.Name), f.Body, 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	buf := &bytes.Buffer{}
-	if err := printer.Print(buf, filtered,
-		printer.WithPackageName(packageFlag),
-		printer.WithGofmt(gofmtFlag),
-		printer.WithPrefixes(prefixFlag),
-		printer.WithServerOnly(serverOnlyFlag),
-		printer.WithClientOnly(clientOnlyFlag),
-		printer.WithCamelize(camelizeFlag),
-	); err != nil {
+	if err := printer.Print(buf, filtered, opts...); err != nil {
 		return err
 	}
 
 	output := os.Stdout
-	if outputFlag != "" {
-		f, err := os.OpenFile(outputFlag, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if t.Output != "" {
+		f, err := os.OpenFile(t.Output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 		if err != nil {
 			return err
 		}
@@ -159,11 +253,11 @@ func connect(system bool) (*dbus.Conn, error) {
 	return dbus.SessionBus()
 }
 
-func parseDest(conn *dbus.Conn, dests []string) ([]*token.Interface, error) {
+func parseDest(conn *dbus.Conn, dests []string, strict bool) ([]*token.Interface, error) {
 	ifaces := make([]*token.Interface, 0, 16)
 	for _, dest := range dests {
 		if err := introspectDest(conn, dest, "/", func(node *introspect.Node) error {
-			chunk, err := parser.ParseNode(node)
+			chunk, err := parser.ParseNode(node, parser.WithStrict(strict))
 			if err != nil {
 				return err
 			}
@@ -176,7 +270,9 @@ func parseDest(conn *dbus.Conn, dests []string) ([]*token.Interface, error) {
 	return ifaces, nil
 }
 
-func generateXML(conn *dbus.Conn, dests []string) ([]byte, error) {
+func generateXML(
+	conn *dbus.Conn, dests []string, isNeeded func(iface string) bool,
+) ([]byte, error) {
 	var ifaces []introspect.Interface
 	for _, dest := range dests {
 		if err := introspectDest(conn, dest, "/", func(n *introspect.Node) error {
@@ -218,10 +314,10 @@ func merge(curr, next []*token.Interface) []*token.Interface {
 	return curr
 }
 
-func isNeeded(iface string) bool {
-	return len(onlyFlag) == 0 && len(exceptFlag) == 0 ||
-		len(onlyFlag) != 0 && includes(onlyFlag, iface) ||
-		len(exceptFlag) != 0 && !includes(exceptFlag, iface)
+func (t *target) isNeeded(iface string) bool {
+	return len(t.Only) == 0 && len(t.Except) == 0 ||
+		len(t.Only) != 0 && includes(t.Only, iface) ||
+		len(t.Except) != 0 && !includes(t.Except, iface)
 }
 
 func includes(ss []string, s string) bool {
@@ -270,3 +366,15 @@ func (ss *stringsVar) Set(arg string) error {
 	}
 	return nil
 }
+
+// listVar is a repeatable flag, unlike stringsVar values can contain commas.
+type listVar []string
+
+func (ls *listVar) String() string {
+	return "[" + strings.Join(*ls, ", ") + "]"
+}
+
+func (ls *listVar) Set(arg string) error {
+	*ls = append(*ls, arg)
+	return nil
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SignatureError is returned when an introspection document
+// contains a signature that cannot be parsed.
+type SignatureError struct {
+	Interface string // interface name
+	Member    string // method, property or signal name
+	Arg       string // argument name or its #index when it's unnamed
+	Signature string // the whole invalid signature
+	Offset    int    // byte offset of the error in the signature
+	Reason    string // human readable description
+}
+
+func (e *SignatureError) Error() string {
+	var b strings.Builder
+	if e.Interface != "" {
+		b.WriteString(e.Interface)
+		if e.Member != "" {
+			b.WriteByte('.')
+			b.WriteString(e.Member)
+		}
+		b.WriteString(": ")
+	}
+	if e.Arg != "" {
+		fmt.Fprintf(&b, "arg %s: ", e.Arg)
+	}
+	fmt.Fprintf(&b, "invalid signature %q at offset %d: %s",
+		e.Signature, e.Offset, e.Reason)
+	return b.String()
+}
+
+func sigErr(off int, reason string) error {
+	return &SignatureError{Offset: off, Reason: reason}
+}
+
+func withInterface(err error, name string) error {
+	if e, ok := err.(*SignatureError); ok && e.Interface == "" {
+		e.Interface = name
+	}
+	return err
+}
+
+func withMember(err error, name string) error {
+	if e, ok := err.(*SignatureError); ok && e.Member == "" {
+		e.Member = name
+	}
+	return err
+}
+
+func withArg(err error, name string) error {
+	if e, ok := err.(*SignatureError); ok && e.Arg == "" {
+		e.Arg = name
+	}
+	return err
+}
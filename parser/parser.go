@@ -3,76 +3,136 @@ package parser
 import (
 	"encoding/xml"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/amenzhinsky/dbus-codegen-go/token"
 	"github.com/godbus/dbus/v5/introspect"
 )
 
+// ParseOption is a Parse and ParseNode configuration option.
+type ParseOption func(p *parser)
+
+// WithStrict makes the parser validate all signatures against
+// the D-Bus specification, see ValidateSignature.
+//
+// Otherwise it accepts every signature it's able to map
+// to Go types, e.g. empty structs or non-basic dict keys.
+func WithStrict(enable bool) ParseOption {
+	return func(p *parser) {
+		p.strict = enable
+	}
+}
+
+type parser struct {
+	strict bool
+}
+
 // Parse parses the given introspection XML into a list of interfaces.
-func Parse(b []byte) ([]*token.Interface, error) {
+func Parse(b []byte, opts ...ParseOption) ([]*token.Interface, error) {
 	var node introspect.Node
 	if err := xml.Unmarshal(b, &node); err != nil {
 		return nil, err
 	}
-	return ParseNode(&node)
+	return ParseNode(&node, opts...)
 }
 
 // ParseNode parses the given node, used to avoid double unmarshalling.
-func ParseNode(node *introspect.Node) ([]*token.Interface, error) {
+func ParseNode(node *introspect.Node, opts ...ParseOption) ([]*token.Interface, error) {
 	if node == nil {
 		panic("node is nil")
 	}
+	p := &parser{}
+	for _, opt := range opts {
+		opt(p)
+	}
 	ifaces := make([]*token.Interface, len(node.Interfaces))
 	for i := range node.Interfaces {
-		ifaces[i] = &token.Interface{
-			Name:        node.Interfaces[i].Name,
-			Methods:     parseMethods(node.Interfaces[i].Methods),
-			Properties:  parseProperties(node.Interfaces[i].Properties),
-			Signals:     parseSignals(node.Interfaces[i].Signals),
-			Annotations: parseAnnotations(node.Interfaces[i].Annotations),
+		iface, err := p.parseInterface(&node.Interfaces[i])
+		if err != nil {
+			return nil, err
 		}
+		ifaces[i] = iface
 	}
 	return ifaces, nil
 }
 
-func parseMethods(methods []introspect.Method) []*token.Method {
+func (p *parser) parseInterface(iface *introspect.Interface) (*token.Interface, error) {
+	methods, err := p.parseMethods(iface.Methods)
+	if err != nil {
+		return nil, withInterface(err, iface.Name)
+	}
+	props, err := p.parseProperties(iface.Properties)
+	if err != nil {
+		return nil, withInterface(err, iface.Name)
+	}
+	signals, err := p.parseSignals(iface.Signals)
+	if err != nil {
+		return nil, withInterface(err, iface.Name)
+	}
+	return &token.Interface{
+		Name:        iface.Name,
+		Methods:     methods,
+		Properties:  props,
+		Signals:     signals,
+		Annotations: parseAnnotations(iface.Annotations),
+	}, nil
+}
+
+func (p *parser) parseMethods(methods []introspect.Method) ([]*token.Method, error) {
 	list := make([]*token.Method, len(methods))
 	for i := range methods {
+		in, err := p.parseArgs(methods[i].Args, "in")
+		if err != nil {
+			return nil, withMember(err, methods[i].Name)
+		}
+		out, err := p.parseArgs(methods[i].Args, "out")
+		if err != nil {
+			return nil, withMember(err, methods[i].Name)
+		}
 		list[i] = &token.Method{
 			Name:        methods[i].Name,
-			In:          parseArgs(methods[i].Args, "in"),
-			Out:         parseArgs(methods[i].Args, "out"),
+			In:          in,
+			Out:         out,
+			Args:        mergeArgs(methods[i].Args, in, out),
 			Annotations: parseAnnotations(methods[i].Annotations),
 		}
 	}
-	return list
+	return list, nil
 }
 
-func parseProperties(props []introspect.Property) []*token.Property {
+func (p *parser) parseProperties(props []introspect.Property) ([]*token.Property, error) {
 	properties := make([]*token.Property, len(props))
 	for i := range props {
+		arg, err := p.parseArg(props[i].Name, props[i].Type)
+		if err != nil {
+			return nil, withMember(err, props[i].Name)
+		}
 		properties[i] = &token.Property{
 			Name:        props[i].Name,
-			Arg:         parseArg(props[i].Name, props[i].Type),
+			Arg:         arg,
 			Read:        strings.Contains(props[i].Access, "read"),
 			Write:       strings.Contains(props[i].Access, "write"),
 			Annotations: parseAnnotations(props[i].Annotations),
 		}
 	}
-	return properties
+	return properties, nil
 }
 
-func parseSignals(sigs []introspect.Signal) []*token.Signal {
+func (p *parser) parseSignals(sigs []introspect.Signal) ([]*token.Signal, error) {
 	signals := make([]*token.Signal, len(sigs))
 	for i := range sigs {
+		args, err := p.parseArgs(sigs[i].Args, "")
+		if err != nil {
+			return nil, withMember(err, sigs[i].Name)
+		}
 		signals[i] = &token.Signal{
 			Name:        sigs[i].Name,
-			Args:        parseArgs(sigs[i].Args, ""),
+			Args:        args,
 			Annotations: parseAnnotations(sigs[i].Annotations),
 		}
 	}
-	return signals
+	return signals, nil
 }
 
 func parseAnnotations(annotations []introspect.Annotation) []*token.Annotation {
@@ -86,78 +146,140 @@ func parseAnnotations(annotations []introspect.Annotation) []*token.Annotation {
 	return out
 }
 
-func parseArgs(args []introspect.Arg, direction string) []*token.Arg {
+func (p *parser) parseArgs(args []introspect.Arg, direction string) ([]*token.Arg, error) {
 	out := make([]*token.Arg, 0, len(args))
 	for i := range args {
 		if direction != "" && args[i].Direction != direction {
 			continue
 		}
-		out = append(out, parseArg(args[i].Name, args[i].Type))
+		arg, err := p.parseArg(args[i].Name, args[i].Type)
+		if err != nil {
+			if args[i].Name == "" {
+				return nil, withArg(err, "#"+strconv.Itoa(i))
+			}
+			return nil, withArg(err, args[i].Name)
+		}
+		arg.Direction = direction
+		out = append(out, arg)
 	}
-	return out
+	return out, nil
+}
+
+// mergeArgs restores the declaration order of parsed input and output arguments.
+func mergeArgs(args []introspect.Arg, in, out []*token.Arg) []*token.Arg {
+	merged := make([]*token.Arg, 0, len(in)+len(out))
+	for i := range args {
+		switch args[i].Direction {
+		case "in":
+			merged, in = append(merged, in[0]), in[1:]
+		case "out":
+			merged, out = append(merged, out[0]), out[1:]
+		}
+	}
+	return merged
 }
 
-func parseArg(name, typ string) *token.Arg {
-	return &token.Arg{Name: name, Type: parseSig(typ)}
+func (p *parser) parseArg(name, typ string) (*token.Arg, error) {
+	if p.strict {
+		if err := ValidateSignature(typ); err != nil {
+			return nil, err
+		}
+	}
+	s, err := parseSig(typ)
+	if err != nil {
+		return nil, err
+	}
+	return &token.Arg{Name: name, Type: s}, nil
 }
 
-func parseSig(sig string) string {
-	s, rlen := next(sig)
+func parseSig(sig string) (*token.Type, error) {
+	if sig == "" {
+		return nil, &SignatureError{Reason: "empty signature"}
+	}
+	t, rlen, err := next(sig, 0)
+	if err != nil {
+		err.(*SignatureError).Signature = sig
+		return nil, err
+	}
 	if len(sig) != rlen {
-		panic(fmt.Sprintf("warn: %q invalid signature", sig))
+		return nil, &SignatureError{
+			Signature: sig,
+			Offset:    rlen,
+			Reason:    "single complete type expected",
+		}
 	}
-	return s
+	return t, nil
 }
 
-func next(s string) (string, int) {
+var basicKinds = map[byte]token.Kind{
+	'y': token.KindByte,
+	'b': token.KindBoolean,
+	'n': token.KindInt16,
+	'q': token.KindUint16,
+	'i': token.KindInt32,
+	'u': token.KindUint32,
+	'x': token.KindInt64,
+	't': token.KindUint64,
+	'd': token.KindDouble,
+	'h': token.KindUnixFD,
+	's': token.KindString,
+	'o': token.KindObjectPath,
+	'g': token.KindSignature,
+	'v': token.KindVariant,
+}
+
+// next parses the first complete type of s that starts at
+// the given offset of the whole signature, the offset is used
+// only for error reporting.
+//
+// It returns nil type and zero length when s is empty.
+func next(s string, off int) (*token.Type, int, error) {
 	if len(s) == 0 {
-		return "", 0
+		return nil, 0, nil
+	}
+	if kind, ok := basicKinds[s[0]]; ok {
+		return &token.Type{Kind: kind, Signature: s[:1]}, 1, nil
 	}
 	switch s[0] {
-	case 'y':
-		return "byte", 1
-	case 'b':
-		return "bool", 1
-	case 'n':
-		return "int16", 1
-	case 'q':
-		return "uint16", 1
-	case 'i':
-		return "int32", 1
-	case 'u':
-		return "uint32", 1
-	case 'x':
-		return "int64", 1
-	case 't':
-		return "uint64", 1
-	case 'd':
-		return "float64", 1
-	case 'h':
-		return "dbus.UnixFD", 1
-	case 's':
-		return "string", 1
-	case 'o':
-		return "dbus.ObjectPath", 1
-	case 'v':
-		return "dbus.Variant", 1
-	case 'g':
-		return "dbus.Signature", 1
 	case 'a':
+		if len(s) == 1 {
+			return nil, 0, sigErr(off+1, "missing array element type")
+		}
 		if s[1] == '{' { // dictionary
-			i := 4
-			k, rlen := next(s[2:])
+			k, rlen, err := next(s[2:], off+2)
+			if err != nil {
+				return nil, 0, err
+			}
 			if rlen != 1 {
-				panic("key is not a primitive")
+				return nil, 0, sigErr(off+2, "dict key is not a basic type")
+			}
+			v, rlen, err := next(s[3:], off+3)
+			if err != nil {
+				return nil, 0, err
 			}
-			v, rlen := next(s[3:])
 			if rlen == 0 {
-				panic("value is not available")
+				return nil, 0, sigErr(off+3, "missing dict value type")
+			}
+			i := 3 + rlen
+			if i >= len(s) || s[i] != '}' {
+				return nil, 0, sigErr(off+i, "unterminated dict entry")
 			}
-			i += rlen
-			return "map[" + k + "]" + v, i
+			return &token.Type{
+				Kind:      token.KindDict,
+				Signature: s[:i+1],
+				Key:       k,
+				Elem:      v,
+			}, i + 1, nil
+		}
+		elem, rlen, err := next(s[1:], off+1)
+		if err != nil {
+			return nil, 0, err
 		}
-		s, rlen := next(s[1:])
-		return "[]" + s, rlen + 1
+		return &token.Type{
+			Kind:      token.KindArray,
+			Signature: s[:rlen+1],
+			Elem:      elem,
+		}, rlen + 1, nil
 	case '(':
 		i := 1
 		n := 1
@@ -169,21 +291,32 @@ func next(s string) (string, int) {
 			}
 			i++
 		}
-		return "struct {" + strings.Join(structFields(s[1:i-1]), ";") + "}", i
+		if n != 0 {
+			return nil, 0, sigErr(off+len(s), "unterminated struct")
+		}
+		fields, err := structFields(s[1:i-1], off+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return &token.Type{
+			Kind:      token.KindStruct,
+			Signature: s[:i],
+			Fields:    fields,
+		}, i, nil
 	default:
-		panic("not supported signature: " + string(s[0]))
+		return nil, 0, sigErr(off, fmt.Sprintf("unsupported type code %q", s[0]))
 	}
 }
 
-func structFields(sig string) []string {
-	fields := make([]string, 0, len(sig))
-	for i, v := 0, 0; i < len(sig); v++ {
-		s, rlen := next(sig[i:])
-		if rlen == 0 {
-			break
+func structFields(sig string, off int) ([]*token.Type, error) {
+	fields := make([]*token.Type, 0, len(sig))
+	for i := 0; i < len(sig); {
+		t, rlen, err := next(sig[i:], off+i)
+		if err != nil {
+			return nil, err
 		}
 		i += rlen
-		fields = append(fields, fmt.Sprintf("V%d %s", v, s))
+		fields = append(fields, t)
 	}
-	return fields
+	return fields, nil
 }
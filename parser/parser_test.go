@@ -1,34 +1,179 @@
 package parser
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/amenzhinsky/dbus-codegen-go/token"
 )
 
 func TestParseSig(t *testing.T) {
 	t.Parallel()
 	for s, want := range map[string]string{
-		"y":        "byte",
-		"b":        "bool",
-		"n":        "int16",
-		"q":        "uint16",
-		"i":        "int32",
-		"u":        "uint32",
-		"x":        "int64",
-		"t":        "uint64",
-		"d":        "float64",
-		"h":        "dbus.UnixFD",
-		"s":        "string",
-		"o":        "dbus.ObjectPath",
-		"v":        "dbus.Variant",
-		"g":        "dbus.Signature",
-		"ai":       "[]int32",
-		"aai":      "[][]int32",
-		"aaaa{sb}": "[][][]map[string]bool",
-		"a{yv}":    "map[byte]dbus.Variant",
-		"(ybv)":    "struct {V0 byte;V1 bool;V2 dbus.Variant}",
+		"y":         "byte",
+		"b":         "boolean",
+		"n":         "int16",
+		"q":         "uint16",
+		"i":         "int32",
+		"u":         "uint32",
+		"x":         "int64",
+		"t":         "uint64",
+		"d":         "double",
+		"h":         "unix_fd",
+		"s":         "string",
+		"o":         "object_path",
+		"v":         "variant",
+		"g":         "signature",
+		"ai":        "array<int32>",
+		"aai":       "array<array<int32>>",
+		"aaaa{sb}":  "array<array<array<dict<string,boolean>>>>",
+		"a{yv}":     "dict<byte,variant>",
+		"(ybv)":     "struct<byte,boolean,variant>",
+		"a(oa{sv})": "array<struct<object_path,dict<string,variant>>>",
+	} {
+		have, err := parseSig(s)
+		if err != nil {
+			t.Errorf("parseSig(%q) error: %s", s, err)
+			continue
+		}
+		if have.Signature != s {
+			t.Errorf("parseSig(%q).Signature = %q", s, have.Signature)
+		}
+		if kinds := formatKinds(have); kinds != want {
+			t.Errorf("parseSig(%q) = %s, want %s", s, kinds, want)
+		}
+	}
+}
+
+func formatKinds(t *token.Type) string {
+	switch t.Kind {
+	case token.KindArray:
+		return "array<" + formatKinds(t.Elem) + ">"
+	case token.KindDict:
+		return "dict<" + formatKinds(t.Key) + "," + formatKinds(t.Elem) + ">"
+	case token.KindStruct:
+		fields := make([]string, len(t.Fields))
+		for i := range t.Fields {
+			fields[i] = formatKinds(t.Fields[i])
+		}
+		return "struct<" + strings.Join(fields, ",") + ">"
+	default:
+		return t.Kind.String()
+	}
+}
+
+func TestParseSigInvalid(t *testing.T) {
+	t.Parallel()
+	for s, want := range map[string]int{
+		"":       0,
+		"a":      1,
+		"aa":     2,
+		"a{":     2,
+		"a{s":    3,
+		"a{ss":   4,
+		"a{ais}": 2,
+		"(ii":    3,
+		"ii":     1,
+		"z":      0,
+		"a(iz)":  3,
+	} {
+		_, err := parseSig(s)
+		if err == nil {
+			t.Errorf("parseSig(%q) error = nil, want an error", s)
+			continue
+		}
+		if have := err.(*SignatureError).Offset; have != want {
+			t.Errorf("parseSig(%q) offset = %d, want %d", s, have, want)
+		}
+	}
+}
+
+func TestParseSignatureError(t *testing.T) {
+	t.Parallel()
+	_, err := Parse([]byte(`<node>
+	<interface name="org.example.Foo">
+		<method name="Bar">
+			<arg name="ok" type="s" direction="in"/>
+			<arg type="a{" direction="out"/>
+		</method>
+	</interface>
+</node>`))
+	serr, ok := err.(*SignatureError)
+	if !ok {
+		t.Fatalf("Parse error = %v, want *SignatureError", err)
+	}
+	want := SignatureError{
+		Interface: "org.example.Foo",
+		Member:    "Bar",
+		Arg:       "#1",
+		Signature: "a{",
+		Offset:    2,
+		Reason:    serr.Reason,
+	}
+	if *serr != want {
+		t.Errorf("Parse error = %#v, want %#v", *serr, want)
+	}
+}
+
+func TestValidateSignature(t *testing.T) {
+	t.Parallel()
+	for _, s := range []string{
+		"",
+		"y",
+		"sa{sv}",
+		"a(ssssssouso)",
+		"aa{oa{sa{sv}}}",
+		strings.Repeat("a", 32) + "i",
+		strings.Repeat("(", 32) + "i" + strings.Repeat(")", 32),
+		strings.Repeat("s", 255),
+	} {
+		if err := ValidateSignature(s); err != nil {
+			t.Errorf("ValidateSignature(%q) error: %s", s, err)
+		}
+	}
+
+	for s, want := range map[string]int{
+		"a":                               1,
+		"{sv}":                            0,
+		"a{vs}":                           2,
+		"a{as}":                           2,
+		"a{s}":                            3,
+		"a{sss}":                          4,
+		"a{ss":                            4,
+		"()":                              1,
+		"(i":                              2,
+		"i)":                              1,
+		"m":                               0,
+		"ai*":                             2,
+		"a?":                              1,
+		"r":                               0,
+		strings.Repeat("a", 33) + "i":     32,
+		strings.Repeat("(", 33) + "i":     32,
+		strings.Repeat("(", 32) + "a{si}": 33,
+		strings.Repeat("s", 256):          255,
 	} {
-		if have := parseSig(s); have != want {
-			t.Errorf("parseSig(%q) = %q, want %q", s, have, want)
+		err := ValidateSignature(s)
+		if err == nil {
+			t.Errorf("ValidateSignature(%q) error = nil, want an error", s)
+			continue
 		}
+		if have := err.(*SignatureError).Offset; have != want {
+			t.Errorf("ValidateSignature(%q) offset = %d, want %d (%s)", s, have, want, err)
+		}
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	t.Parallel()
+	b := []byte(`<node>
+	<interface name="org.example.Foo">
+		<property name="Bar" type="a{vs}" access="read"/>
+	</interface>
+</node>`)
+	if _, err := Parse(b); err != nil {
+		t.Fatalf("Parse error: %s", err)
+	}
+	if _, err := Parse(b, WithStrict(true)); err == nil {
+		t.Fatal("Parse(WithStrict(true)) error = nil, want an error")
 	}
 }
@@ -0,0 +1,152 @@
+package parser
+
+import "fmt"
+
+// Limits defined by the D-Bus specification,
+// dict entries are counted as structs.
+const (
+	maxSignatureLen = 255
+	maxArrayDepth   = 32
+	maxStructDepth  = 32
+)
+
+// ValidateSignature checks that the given string is a valid D-Bus
+// signature according to the specification, it may consist of
+// any number of complete types.
+//
+// Returned errors are always of *SignatureError type.
+func ValidateSignature(sig string) error {
+	if len(sig) > maxSignatureLen {
+		return &SignatureError{
+			Signature: sig,
+			Offset:    maxSignatureLen,
+			Reason:    fmt.Sprintf("signature is longer than %d bytes", maxSignatureLen),
+		}
+	}
+	v := &validator{sig: sig}
+	for v.off < len(sig) {
+		if err := v.next(); err != nil {
+			err.(*SignatureError).Signature = sig
+			return err
+		}
+	}
+	return nil
+}
+
+type validator struct {
+	sig     string
+	off     int
+	arrays  int
+	structs int
+}
+
+func (v *validator) next() error {
+	if v.off >= len(v.sig) {
+		return sigErr(v.off, "unexpected end of signature")
+	}
+	c := v.sig[v.off]
+	switch {
+	case isBasic(c), c == 'v':
+		v.off++
+		return nil
+	case c == 'a':
+		return v.array()
+	case c == '(':
+		return v.strct()
+	case c == '{':
+		return sigErr(v.off, "dict entry is allowed only as an array element")
+	case c == ')', c == '}':
+		return sigErr(v.off, fmt.Sprintf("unexpected %q", c))
+	case isReserved(c):
+		return sigErr(v.off, fmt.Sprintf("reserved type code %q", c))
+	default:
+		return sigErr(v.off, fmt.Sprintf("unsupported type code %q", c))
+	}
+}
+
+func (v *validator) array() error {
+	if v.arrays++; v.arrays > maxArrayDepth {
+		return sigErr(v.off, fmt.Sprintf("arrays are nested deeper than %d levels", maxArrayDepth))
+	}
+	defer func() { v.arrays-- }()
+
+	v.off++
+	if v.off >= len(v.sig) {
+		return sigErr(v.off, "missing array element type")
+	}
+	if v.sig[v.off] == '{' {
+		return v.dict()
+	}
+	return v.next()
+}
+
+func (v *validator) dict() error {
+	if v.structs++; v.structs > maxStructDepth {
+		return sigErr(v.off, fmt.Sprintf("structs are nested deeper than %d levels", maxStructDepth))
+	}
+	defer func() { v.structs-- }()
+
+	v.off++
+	if v.off >= len(v.sig) {
+		return sigErr(v.off, "missing dict key type")
+	}
+	if !isBasic(v.sig[v.off]) {
+		return sigErr(v.off, "dict key is not a basic type")
+	}
+	v.off++
+	if v.off >= len(v.sig) || v.sig[v.off] == '}' {
+		return sigErr(v.off, "missing dict value type")
+	}
+	if err := v.next(); err != nil {
+		return err
+	}
+	if v.off >= len(v.sig) || v.sig[v.off] != '}' {
+		return sigErr(v.off, "dict entry must contain exactly two types")
+	}
+	v.off++
+	return nil
+}
+
+func (v *validator) strct() error {
+	if v.structs++; v.structs > maxStructDepth {
+		return sigErr(v.off, fmt.Sprintf("structs are nested deeper than %d levels", maxStructDepth))
+	}
+	defer func() { v.structs-- }()
+
+	v.off++
+	if v.off < len(v.sig) && v.sig[v.off] == ')' {
+		return sigErr(v.off, "empty structs are not allowed")
+	}
+	for {
+		if v.off >= len(v.sig) {
+			return sigErr(v.off, "unterminated struct")
+		}
+		if v.sig[v.off] == ')' {
+			v.off++
+			return nil
+		}
+		if err := v.next(); err != nil {
+			return err
+		}
+	}
+}
+
+func isBasic(c byte) bool {
+	switch c {
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 'h', 's', 'o', 'g':
+		return true
+	default:
+		return false
+	}
+}
+
+// isReserved reports whether the given type code is reserved
+// by the specification and must not appear in signatures.
+func isReserved(c byte) bool {
+	switch c {
+	case 'r', 'e', 'm', '*', '?', '@', '&', '^':
+		return true
+	default:
+		return false
+	}
+}
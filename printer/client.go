@@ -0,0 +1,289 @@
+package printer
+
+// clientTpl is a client-side runtime for subscribing to signals.
+const clientTpl = `{{define "client"}}{{import "context"}}{{import "strings"}}{{import "github.com/godbus/dbus/v5"}}
+// WatchOption is an option of signal Watch functions and SignalDispatcher handlers.
+type WatchOption func(w *watcher)
+
+// WithWatchPath receives signals emitted by the named object only.
+func WithWatchPath(path dbus.ObjectPath) WatchOption {
+	return func(w *watcher) {
+		w.path = path
+	}
+}
+
+// WithWatchPathNamespace receives signals emitted by
+// the named object and objects below it only.
+func WithWatchPathNamespace(namespace dbus.ObjectPath) WatchOption {
+	return func(w *watcher) {
+		w.namespace = namespace
+	}
+}
+
+// WithWatchSender receives signals emitted by the named sender only,
+// well-known names are tracked to match signals of their current owners.
+func WithWatchSender(sender string) WatchOption {
+	return func(w *watcher) {
+		w.sender = sender
+	}
+}
+
+// withWatchArg0 receives signals with the given first string argument only.
+func withWatchArg0(arg0 string) WatchOption {
+	return func(w *watcher) {
+		w.arg0 = arg0
+	}
+}
+
+// watcher is a signal subscription.
+type watcher struct {
+	name      string // interface and member names
+	arg0      string
+	path      dbus.ObjectPath
+	namespace dbus.ObjectPath
+	sender    string
+	owner     string // unique name of the sender
+
+	match      []dbus.MatchOption
+	ownerMatch []dbus.MatchOption
+}
+
+const busName = "org.freedesktop.DBus"
+
+func newWatcher(iface, member string, opts []WatchOption) *watcher {
+	w := &watcher{name: iface + "." + member}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.match = []dbus.MatchOption{
+		dbus.WithMatchInterface(iface),
+		dbus.WithMatchMember(member),
+	}
+	if w.path != "" {
+		w.match = append(w.match, dbus.WithMatchObjectPath(w.path))
+	}
+	if w.namespace != "" {
+		w.match = append(w.match, dbus.WithMatchPathNamespace(w.namespace))
+	}
+	if w.sender != "" {
+		w.match = append(w.match, dbus.WithMatchSender(w.sender))
+	}
+	if w.arg0 != "" {
+		w.match = append(w.match, dbus.WithMatchArg(0, w.arg0))
+	}
+	if w.sender != "" && w.sender != busName && !strings.HasPrefix(w.sender, ":") {
+		w.ownerMatch = []dbus.MatchOption{
+			dbus.WithMatchSender(busName),
+			dbus.WithMatchInterface(busName),
+			dbus.WithMatchMember("NameOwnerChanged"),
+			dbus.WithMatchArg(0, w.sender),
+		}
+	}
+	return w
+}
+
+// addMatch installs the watcher's match rules
+// and resolves the sender's current owner.
+func (w *watcher) addMatch(ctx context.Context, conn *dbus.Conn) error {
+	if err := conn.AddMatchSignal(w.match...); err != nil {
+		return err
+	}
+	if w.ownerMatch == nil {
+		return nil
+	}
+	if err := conn.AddMatchSignal(w.ownerMatch...); err != nil {
+		conn.RemoveMatchSignal(w.match...)
+		return err
+	}
+	if err := conn.BusObject().CallWithContext(
+		ctx, busName+".GetNameOwner", 0, w.sender,
+	).Store(&w.owner); err != nil {
+		if e, ok := err.(dbus.Error); !ok || e.Name != busName+".Error.NameHasNoOwner" {
+			w.removeMatch(conn)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMatch removes the watcher's match rules.
+func (w *watcher) removeMatch(conn *dbus.Conn) {
+	conn.RemoveMatchSignal(w.match...)
+	if w.ownerMatch != nil {
+		conn.RemoveMatchSignal(w.ownerMatch...)
+	}
+}
+
+// matches reports whether the signal satisfies the watcher's filters,
+// sender's owner changes are tracked along the way.
+func (w *watcher) matches(sig *dbus.Signal) bool {
+	if w.ownerMatch != nil && sig.Sender == busName &&
+		sig.Name == busName+".NameOwnerChanged" &&
+		len(sig.Body) == 3 && sig.Body[0] == w.sender {
+		w.owner, _ = sig.Body[2].(string)
+		return false
+	}
+	if sig.Name != w.name {
+		return false
+	}
+	if w.arg0 != "" && (len(sig.Body) == 0 || sig.Body[0] != w.arg0) {
+		return false
+	}
+	if w.path != "" && sig.Path != w.path {
+		return false
+	}
+	if w.namespace != "" && w.namespace != "/" && sig.Path != w.namespace &&
+		!strings.HasPrefix(string(sig.Path), string(w.namespace)+"/") {
+		return false
+	}
+	switch {
+	case w.sender == "":
+		return true
+	case w.owner != "":
+		return sig.Sender == w.owner
+	default:
+		return sig.Sender == w.sender
+	}
+}
+
+// watch installs the watcher's match rules and delivers matching signals
+// to the returned channel until ctx is done or conn is closed.
+func watch(ctx context.Context, conn *dbus.Conn, w *watcher) (<-chan *dbus.Signal, error) {
+	if err := w.addMatch(ctx, conn); err != nil {
+		return nil, err
+	}
+	sigc := make(chan *dbus.Signal, 16)
+	conn.Signal(sigc)
+	ch := make(chan *dbus.Signal)
+	go func() {
+		defer func() {
+			conn.RemoveSignal(sigc)
+			w.removeMatch(conn)
+			close(ch)
+		}()
+		for {
+			select {
+			case sig, ok := <-sigc:
+				if !ok {
+					return
+				}
+				if !w.matches(sig) {
+					continue
+				}
+				select {
+				case ch <- sig:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+{{end}}`
+
+// dispatcherTpl is a client-side runtime for routing signals to handlers.
+const dispatcherTpl = `{{define "dispatcher"}}{{import "context"}}{{import "sync"}}{{import "github.com/godbus/dbus/v5"}}
+// SignalDispatcher consumes signals of a connection once
+// and routes them to handlers registered with On methods.
+type SignalDispatcher struct {
+	conn *dbus.Conn
+	sigc chan *dbus.Signal
+	stop chan struct{}
+	once sync.Once
+
+	mu       sync.Mutex
+	handlers []*signalHandler
+}
+
+type signalHandler struct {
+	w  *watcher
+	fn func(s Signal)
+}
+
+// NewSignalDispatcher creates a dispatcher of signals received by conn,
+// it has to be closed with Close when it's not needed anymore.
+func NewSignalDispatcher(conn *dbus.Conn) *SignalDispatcher {
+	d := &SignalDispatcher{
+		conn: conn,
+		sigc: make(chan *dbus.Signal, 16),
+		stop: make(chan struct{}),
+	}
+	conn.Signal(d.sigc)
+	go d.dispatch()
+	return d
+}
+
+// dispatch calls handlers matching received signals one by one
+// in order of registration, so handlers shouldn't block.
+func (d *SignalDispatcher) dispatch() {
+	for {
+		select {
+		case sig, ok := <-d.sigc:
+			if !ok {
+				return
+			}
+			var matched []*signalHandler
+			d.mu.Lock()
+			for _, h := range d.handlers {
+				if h.w.matches(sig) {
+					matched = append(matched, h)
+				}
+			}
+			d.mu.Unlock()
+			if len(matched) == 0 {
+				continue
+			}
+			typed, err := LookupSignal(sig)
+			if err != nil {
+				continue
+			}
+			for _, h := range matched {
+				h.fn(typed)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// subscribe registers a handler of signals of the same type as s
+// and returns a function that unregisters it.
+func (d *SignalDispatcher) subscribe(s Signal, opts []WatchOption, fn func(s Signal)) (func(), error) {
+	h := &signalHandler{w: newWatcher(s.Interface(), s.Name(), opts), fn: fn}
+	if err := h.w.addMatch(context.Background(), d.conn); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.handlers = append(d.handlers, h)
+	d.mu.Unlock()
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for i := range d.handlers {
+			if d.handlers[i] == h {
+				d.handlers = append(d.handlers[:i], d.handlers[i+1:]...)
+				h.w.removeMatch(d.conn)
+				return
+			}
+		}
+	}, nil
+}
+
+// Close unregisters all handlers and stops dispatching signals.
+func (d *SignalDispatcher) Close() error {
+	d.once.Do(func() {
+		close(d.stop)
+		d.conn.RemoveSignal(d.sigc)
+		d.mu.Lock()
+		for _, h := range d.handlers {
+			h.w.removeMatch(d.conn)
+		}
+		d.handlers = nil
+		d.mu.Unlock()
+	})
+	return nil
+}
+{{end}}`
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"unicode"
 
 	"github.com/amenzhinsky/dbus-codegen-go/token"
 )
@@ -31,45 +32,137 @@ func newContext(ifaces []*token.Interface, opts ...PrintOption) (*context, error
 		return nil, errors.New("no interfaces given")
 	}
 
-	ctx.tpl = template.New("main").Funcs(template.FuncMap{
-		"haveSignals":        ctx.tplHaveSignals,
-		"ifaceNameConst":     ctx.tplIfaceNameConst,
-		"ifaceType":          ctx.tplIfaceType,
-		"unimplementedType":  ctx.tplUnimplementedType,
-		"serverType":         ctx.tplServerType,
-		"methodType":         ctx.tplMethodType,
-		"methodFlags":        ctx.tplMethodFlags,
-		"methodIsDeprecated": ctx.tplMethodIsDeprecated,
-		"propType":           ctx.tplPropType,
-		"propGetType":        ctx.tplPropGetType,
-		"propSetType":        ctx.tplPropSetType,
-		"propArgName":        ctx.tplPropArgName,
-		"propNeedsGet":       ctx.tplPropNeedsGet,
-		"propNeedsSet":       ctx.tplPropNeedsSet,
-		"signalType":         ctx.tplSignalType,
-		"signalBodyType":     ctx.tplSignalBodyType,
-		"argName":            ctx.tplArgName,
-		"joinMethodInArgs":   ctx.tplJoinMethodInArgs,
-		"joinMethodOutArgs":  ctx.tplJoinMethodOutArgs,
-		"joinArgNames":       ctx.tplJoinArgNames,
-		"joinStoreArgs":      ctx.tplJoinStoreArgs,
-		"joinSignalValues":   ctx.tplJoinSignalValues,
-		"joinSignalArgs":     ctx.tplJoinSignalArgs,
+	if ctx.idiomatic {
+		var err error
+		if ctx.initialisms, err = initialismTable(ctx.extraInitialisms); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.resolveTypes(); err != nil {
+		return nil, err
+	}
+	if err := ctx.resolveNames(); err != nil {
+		return nil, err
+	}
+	if err := ctx.collectStructs(); err != nil {
+		return nil, err
+	}
+
+	ctx.tpl = template.New("header").Funcs(template.FuncMap{
+		"import":                 ctx.tplImport,
+		"haveSignals":            ctx.tplHaveSignals,
+		"haveProperties":         ctx.tplHaveProperties,
+		"haveObjectManager":      ctx.tplHaveObjectManager,
+		"haveReadableProperties": ctx.tplHaveReadableProperties,
+		"ifaceNameConst":         ctx.tplIfaceNameConst,
+		"ifaceType":              ctx.tplIfaceType,
+		"ifaceXML":               ctx.tplIfaceXML,
+		"ifaceXMLConst":          ctx.tplIfaceXMLConst,
+		"unimplementedType":      ctx.tplUnimplementedType,
+		"serverType":             ctx.tplServerType,
+		"clientType":             ctx.tplClientType,
+		"fakeType":               ctx.tplFakeType,
+		"fakeFunc":               ctx.tplFakeFunc,
+		"fakeEmitType":           ctx.tplFakeEmitType,
+		"fakeCallsType":          ctx.tplFakeCallsType,
+		"clientWatchType":        ctx.tplClientWatchType,
+		"methodType":             ctx.tplMethodType,
+		"methodFlags":            ctx.tplMethodFlags,
+		"methodIsDeprecated":     ctx.tplMethodIsDeprecated,
+		"propType":               ctx.tplPropType,
+		"propertiesType":         ctx.tplPropertiesType,
+		"anyReadableProperties":  ctx.tplAnyReadableProperties,
+		"changesType":            ctx.tplChangesType,
+		"changedType":            ctx.tplChangedType,
+		"changesParseType":       ctx.tplChangesParseType,
+		"changesWatchType":       ctx.tplChangesWatchType,
+		"getAllNeeded":           ctx.tplGetAllNeeded,
+		"propGetType":            ctx.tplPropGetType,
+		"propSetType":            ctx.tplPropSetType,
+		"propArgName":            ctx.tplPropArgName,
+		"propNeedsGet":           ctx.tplPropNeedsGet,
+		"propNeedsSet":           ctx.tplPropNeedsSet,
+		"propEmitsChanged":       ctx.tplPropEmitsChanged,
+		"propEmitType":           ctx.tplPropEmitType,
+		"signalType":             ctx.tplSignalType,
+		"signalBodyType":         ctx.tplSignalBodyType,
+		"signalWatchType":        ctx.tplSignalWatchType,
+		"signalOnType":           ctx.tplSignalOnType,
+		"argName":                ctx.tplArgName,
+		"argType":                ctx.tplArgType,
+		"argRawType":             ctx.tplArgRawType,
+		"argRawName":             ctx.tplArgRawName,
+		"argMapped":              ctx.tplArgMapped,
+		"argsMapped":             ctx.tplArgsMapped,
+		"methodMapped":           ctx.tplMethodMapped,
+		"decodeArg":              ctx.tplDecodeArg,
+		"encodeArg":              ctx.tplEncodeArg,
+		"ifaceStructs":           ctx.tplIfaceStructs,
+		"structFields":           ctx.tplStructFields,
+		"joinMethodInArgs":       ctx.tplJoinMethodInArgs,
+		"joinMethodOutArgs":      ctx.tplJoinMethodOutArgs,
+		"joinArgNames":           ctx.tplJoinArgNames,
+		"joinCallArgs":           ctx.tplJoinCallArgs,
+		"joinRawArgs":            ctx.tplJoinRawArgs,
+		"joinStoreArgs":          ctx.tplJoinStoreArgs,
+		"joinSignalValues":       ctx.tplJoinSignalValues,
+		"joinSignalArgs":         ctx.tplJoinSignalArgs,
 	})
+	template.Must(ctx.tpl.Parse(headerTpl))
+	template.Must(ctx.tpl.Parse(commonTpl))
+	template.Must(ctx.tpl.Parse(ifaceTpl))
+	template.Must(ctx.tpl.Parse(clientTpl))
+	template.Must(ctx.tpl.Parse(dispatcherTpl))
+	template.Must(ctx.tpl.Parse(objectsTpl))
+	template.Must(ctx.tpl.Parse(serverTpl))
+	template.Must(ctx.tpl.Parse(fakesTpl))
 	return ctx, nil
 }
 
 type context struct {
-	PackageName string
-	Imports     []string
-	Interfaces  []*token.Interface
-	ServerOnly  bool
-	ClientOnly  bool
+	PackageName   string
+	Imports       []string
+	Interfaces    []*token.Interface
+	ServerOnly    bool
+	ClientOnly    bool
+	Fakes         bool
+	ServerContext bool
 
 	tpl      *template.Template
 	gofmt    bool
 	camelize bool
 	prefixes []string
+	names    map[string]string
+	types    map[string]*TypeMapping
+
+	idiomatic        bool
+	extraInitialisms []string
+	initialisms      []string // longest first
+
+	fieldNames  map[string][]string         // by signature
+	structs     map[string]*structType      // by signature and field names
+	structTypes map[*token.Type]*structType // by type tree nodes
+	structList  []*structType
+
+	// type mappings resolved by resolveTypes, see types.go
+	argTypes    map[*token.Arg]*typeMapping
+	typeImports map[string]string // import paths by package names
+
+	// names resolved by resolveNames, see names.go
+	symbols       symbols
+	ifaceTypes    map[*token.Interface]string
+	methodNames   map[*token.Method]string
+	propNames     map[*token.Property]string
+	propEmitNames map[*token.Property]string
+	signalNames   map[*token.Signal]string
+	argNames      map[*token.Arg]string
+	rawNames      map[*token.Arg]string // of mapped arguments
+
+	// names of client and fake members, see resolveClient
+	clientWatchNames map[*token.Signal]string
+	fakeFuncNames    map[*token.Interface]map[string]string // by client methods
+	fakeEmitNames    map[*token.Signal]string
+	fakeCallsNames   map[*token.Interface]string
 }
 
 // addImport adds a go import package.
@@ -82,19 +175,39 @@ func (ctx *context) addImport(pkg string) {
 	ctx.Imports = append(ctx.Imports, pkg)
 }
 
+// tplImport adds an import to the file being rendered,
+// it has to be called next to the code using the package.
+func (ctx *context) tplImport(pkg string) string {
+	ctx.addImport(pkg)
+	return ""
+}
+
 var ifaceRegexp = regexp.MustCompile(`[._][a-zA-Z0-9]`)
 
 func (ctx *context) tplIfaceType(iface *token.Interface) string {
+	if name, ok := ctx.ifaceTypes[iface]; ok {
+		return name
+	}
+	return ctx.ifaceTypeName(iface)
+}
+
+// ifaceTypeName returns the type name of the interface before resolving
+// conflicts, the longest matching prefix is stripped from its name.
+func (ctx *context) ifaceTypeName(iface *token.Interface) string {
 	name := iface.Name
+	var strip string
 	for _, prefix := range ctx.prefixes {
-		if prefix[len(prefix)-1] == '.' {
-			prefix = prefix[:len(prefix)-1]
-		}
-		if i := strings.Index(name, prefix); i != -1 {
-			name = name[i+len(prefix)+1:]
-			break
+		prefix = strings.TrimSuffix(prefix, ".")
+		if prefix != "" && strings.HasPrefix(name, prefix+".") && len(prefix) > len(strip) {
+			strip = prefix
 		}
 	}
+	if strip != "" {
+		name = name[len(strip)+1:]
+	}
+	if ctx.idiomatic {
+		return ctx.idiomaticName(name, true)
+	}
 	name = strings.Title(name)
 	if isKeyword(name) {
 		return name
@@ -115,8 +228,33 @@ func (ctx *context) tplServerType(iface *token.Interface) string {
 	return ctx.tplIfaceType(iface) + "er"
 }
 
+func (ctx *context) tplClientType(iface *token.Interface) string {
+	return ctx.joinTypeName(ctx.tplIfaceType(iface), "Client")
+}
+
+func (ctx *context) tplFakeType(iface *token.Interface) string {
+	return "Fake" + ctx.tplIfaceType(iface)
+}
+
+// tplClientWatchType is a name of the client's method subscribing to the signal.
+func (ctx *context) tplClientWatchType(signal *token.Signal) string {
+	return ctx.clientWatchNames[signal]
+}
+
+// tplFakeFunc is a name of the fake's field implementing the named client's method.
+func (ctx *context) tplFakeFunc(iface *token.Interface, method string) string {
+	return ctx.fakeFuncNames[iface][method]
+}
+
+func (ctx *context) tplFakeEmitType(signal *token.Signal) string {
+	return ctx.fakeEmitNames[signal]
+}
+
+func (ctx *context) tplFakeCallsType(iface *token.Interface) string {
+	return ctx.fakeCallsNames[iface]
+}
+
 func isKeyword(s string) bool {
-	// TODO: validate it doesn't match imported package names
 	return gotoken.Lookup(s).IsKeyword()
 }
 
@@ -129,12 +267,53 @@ func (ctx *context) tplHaveSignals(ifaces []*token.Interface) bool {
 	return false
 }
 
+func (ctx *context) tplHaveProperties(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		if len(iface.Properties) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// tplHaveObjectManager reports whether org.freedesktop.DBus.ObjectManager
+// is among the interfaces along with its signals to track objects changes.
+func (ctx *context) tplHaveObjectManager(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		if iface.Name == "org.freedesktop.DBus.ObjectManager" {
+			return len(iface.Signals) != 0
+		}
+	}
+	return false
+}
+
+func (ctx *context) tplHaveReadableProperties(iface *token.Interface) bool {
+	for _, prop := range iface.Properties {
+		if prop.Read {
+			return true
+		}
+	}
+	return false
+}
+
+func (ctx *context) tplAnyReadableProperties(ifaces []*token.Interface) bool {
+	for _, iface := range ifaces {
+		if ctx.tplHaveReadableProperties(iface) {
+			return true
+		}
+	}
+	return false
+}
+
 func (ctx *context) tplIfaceNameConst(iface *token.Interface) string {
 	return "Interface" + ctx.tplIfaceType(iface)
 }
 
 func (ctx *context) tplMethodType(method *token.Method) string {
-	return strings.Title(method.Name)
+	if name, ok := ctx.methodNames[method]; ok {
+		return name
+	}
+	return ctx.memberName(method.Name)
 }
 
 func (ctx *context) tplMethodFlags(method *token.Method) string {
@@ -158,7 +337,46 @@ func (ctx *context) tplMethodIsDeprecated(method *token.Method) bool {
 }
 
 func (ctx *context) tplPropType(prop *token.Property) string {
-	return strings.Title(prop.Name)
+	if name, ok := ctx.propNames[prop]; ok {
+		return name
+	}
+	return ctx.memberName(prop.Name)
+}
+
+// tplPropertiesType is a name of the properties snapshot type,
+// <Iface>_Properties would conflict with org.freedesktop.DBus.Properties
+// when org.freedesktop.DBus interface is generated too.
+func (ctx *context) tplPropertiesType(iface *token.Interface) string {
+	return ctx.joinTypeName(ctx.tplIfaceType(iface), "Snapshot")
+}
+
+// tplChangesType is a name of the properties changes type, it's not
+// suffixed with PropertiesChanged that is a signal of many interfaces.
+func (ctx *context) tplChangesType(iface *token.Interface) string {
+	return ctx.joinTypeName(ctx.tplIfaceType(iface), "PropertyChanges")
+}
+
+func (ctx *context) tplChangedType(iface *token.Interface) string {
+	return ctx.joinTypeName(ctx.tplIfaceType(iface), "ChangedProperties")
+}
+
+func (ctx *context) tplChangesParseType(iface *token.Interface) string {
+	return "Parse" + ctx.tplChangesType(iface)
+}
+
+func (ctx *context) tplChangesWatchType(iface *token.Interface) string {
+	return "Watch" + ctx.tplChangesType(iface)
+}
+
+// tplGetAllNeeded reports whether GetAllProperties method
+// doesn't conflict with the interface's methods and properties getters.
+func (ctx *context) tplGetAllNeeded(iface *token.Interface) bool {
+	for _, prop := range iface.Properties {
+		if ctx.tplPropNeedsGet(iface, prop) && ctx.tplPropGetType(prop) == "GetAllProperties" {
+			return false
+		}
+	}
+	return ctx.propNeedsAccessor(iface, "GetAllProperties")
 }
 
 func (ctx *context) tplPropGetType(prop *token.Property) string {
@@ -183,31 +401,96 @@ func (ctx *context) tplPropNeedsGet(iface *token.Interface, prop *token.Property
 	return ctx.propNeedsAccessor(iface, ctx.tplPropGetType(prop))
 }
 
+// tplPropEmitsChanged returns value of the EmitsChangedSignal annotation
+// of the property falling back to the interface's one, "true" by default,
+// write-only properties are invalidated instead not to disclose their values.
+func (ctx *context) tplPropEmitsChanged(iface *token.Interface, prop *token.Property) string {
+	emits := "true"
+loop:
+	for _, annotations := range [][]*token.Annotation{prop.Annotations, iface.Annotations} {
+		for _, annotation := range annotations {
+			if annotation.Name == "org.freedesktop.DBus.Property.EmitsChangedSignal" {
+				switch annotation.Value {
+				case "true", "invalidates", "const", "false":
+					emits = annotation.Value
+					break loop
+				}
+			}
+		}
+	}
+	if emits == "true" && !prop.Read {
+		return "invalidates"
+	}
+	return emits
+}
+
+func (ctx *context) tplPropEmitType(iface *token.Interface, prop *token.Property) string {
+	if name, ok := ctx.propEmitNames[prop]; ok {
+		return name
+	}
+	return "Emit" + ctx.joinTypeName(ctx.tplIfaceType(iface), ctx.tplPropType(prop)+"Changed")
+}
+
 func (ctx *context) propNeedsAccessor(iface *token.Interface, name string) bool {
 	for _, method := range iface.Methods {
-		if method.Name == name {
+		if ctx.tplMethodType(method) == name {
 			return false
 		}
 	}
 	return true
 }
 
-func (ctx *context) tplSignalType(iface *token.Interface, signal *token.Signal) string {
-	join := "_"
-	if ctx.camelize {
-		join = ""
+// joinTypeName joins two parts of a type name with an underscore
+// unless camelization or idiomatic names are enabled.
+func (ctx *context) joinTypeName(a, b string) string {
+	if ctx.camelize || ctx.idiomatic {
+		return a + b
 	}
-	return ctx.tplIfaceType(iface) + join + strings.Title(signal.Name) + "Signal"
+	return a + "_" + b
+}
+
+// signalName returns the signal name used in names of its types and functions.
+func (ctx *context) signalName(signal *token.Signal) string {
+	if name, ok := ctx.signalNames[signal]; ok {
+		return name
+	}
+	return ctx.memberName(signal.Name)
+}
+
+func (ctx *context) tplSignalType(iface *token.Interface, signal *token.Signal) string {
+	return ctx.joinTypeName(ctx.tplIfaceType(iface), ctx.signalName(signal)+"Signal")
 }
 
 func (ctx *context) tplSignalBodyType(iface *token.Interface, signal *token.Signal) string {
 	return ctx.tplSignalType(iface, signal) + "Body"
 }
 
+func (ctx *context) tplSignalWatchType(iface *token.Interface, signal *token.Signal) string {
+	return "Watch" + ctx.joinTypeName(ctx.tplIfaceType(iface), ctx.signalName(signal))
+}
+
+func (ctx *context) tplSignalOnType(iface *token.Interface, signal *token.Signal) string {
+	return "On" + ctx.joinTypeName(ctx.tplIfaceType(iface), ctx.signalName(signal))
+}
+
 var varRegexp = regexp.MustCompile("_+[a-zA-Z0-9]")
 
 func (ctx *context) tplArgName(arg *token.Arg, prefix string, i int, export bool) string {
-	name := arg.Name
+	if name, ok := ctx.argNames[arg]; ok {
+		return name
+	}
+	return ctx.argName(arg, prefix, i, export)
+}
+
+// argName returns the argument name before resolving conflicts,
+// unnamed arguments and ones without valid characters are named
+// after prefix and their index, keywords and names starting
+// with a digit are prefixed, e.g. "type" becomes "inType".
+func (ctx *context) argName(arg *token.Arg, prefix string, i int, export bool) string {
+	if ctx.idiomatic {
+		return ctx.idiomaticArgName(arg, prefix, i, export)
+	}
+	name := strings.TrimLeft(identifier(arg.Name), "_")
 	if name == "" {
 		name = prefix + strconv.Itoa(i)
 	} else {
@@ -219,8 +502,11 @@ func (ctx *context) tplArgName(arg *token.Arg, prefix string, i int, export bool
 	if export {
 		name = strings.Title(name)
 	}
-	if isKeyword(name) {
-		return prefix + strings.Title(name)
+	if isKeyword(name) || unicode.IsDigit(rune(name[0])) {
+		name = prefix + strings.Title(name)
+		if export {
+			name = strings.Title(name)
+		}
 	}
 	return name
 }
@@ -229,6 +515,8 @@ func (ctx *context) tplPropArgName(prop *token.Property) string {
 	return ctx.tplArgName(prop.Arg, "v", 0, false)
 }
 
+// tplJoinStoreArgs joins pointers to the given output arguments,
+// raw variables are used for mapped arguments.
 func (ctx *context) tplJoinStoreArgs(args []*token.Arg) string {
 	var buf strings.Builder
 	for i := range args {
@@ -236,7 +524,11 @@ func (ctx *context) tplJoinStoreArgs(args []*token.Arg) string {
 			buf.WriteByte(',')
 		}
 		buf.WriteByte('&')
-		buf.WriteString(ctx.tplArgName(args[i], "out", i, false))
+		if ctx.tplArgMapped(args[i]) {
+			buf.WriteString(ctx.tplArgRawName(args[i]))
+		} else {
+			buf.WriteString(ctx.tplArgName(args[i], "out", i, false))
+		}
 	}
 	return buf.String()
 }
@@ -246,16 +538,33 @@ func (ctx *context) tplJoinArgs(args []*token.Arg, separator byte, suffix string
 	for i := range args {
 		buf.WriteString(ctx.tplArgName(args[i], suffix, i, export))
 		buf.WriteByte(' ')
-		buf.WriteString(args[i].Type)
+		buf.WriteString(ctx.tplArgType(args[i]))
 		buf.WriteByte(separator)
 	}
 	return buf.String()
 }
 
+// tplJoinRawArgs is tplJoinArgs with D-Bus types, mapped arguments are
+// named after their raw variables.
+func (ctx *context) tplJoinRawArgs(args []*token.Arg, prefix string) string {
+	var buf strings.Builder
+	for i := range args {
+		if ctx.tplArgMapped(args[i]) {
+			buf.WriteString(ctx.tplArgRawName(args[i]))
+		} else {
+			buf.WriteString(ctx.tplArgName(args[i], prefix, i, false))
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(ctx.tplArgRawType(args[i]))
+		buf.WriteByte(',')
+	}
+	return buf.String()
+}
+
 func (ctx *context) tplJoinSignalValues(prefix string, sig *token.Signal) string {
 	var buf strings.Builder
 	for i := range sig.Args {
-		buf.WriteString(prefix + ctx.tplArgName(sig.Args[i], "v", i, true))
+		buf.WriteString(ctx.tplEncodeArg(sig.Args[i], prefix+ctx.tplArgName(sig.Args[i], "v", i, true)))
 		buf.WriteByte(',')
 	}
 	return buf.String()
@@ -283,3 +592,15 @@ func (ctx *context) tplJoinArgNames(args []*token.Arg) string {
 	}
 	return buf.String()
 }
+
+// tplJoinCallArgs is tplJoinArgNames with mapped arguments encoded.
+func (ctx *context) tplJoinCallArgs(args []*token.Arg) string {
+	var buf strings.Builder
+	for i := range args {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(ctx.tplEncodeArg(args[i], ctx.tplArgName(args[i], "in", i, false)))
+	}
+	return buf.String()
+}
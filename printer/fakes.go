@@ -0,0 +1,219 @@
+package printer
+
+// fakesTpl contains code shared by all fakes.
+const fakesTpl = `{{define "fakes"}}{{import "context"}}{{import "sync"}}
+// FakeCall is a method call or a property access recorded by a fake client.
+type FakeCall struct {
+	Method string        // Go method name, e.g. GetVersion for property getters
+	Args   []interface{} // arguments except the context
+}
+
+// fake records calls and delivers signals injected into fakes.
+type fake struct {
+	mu    sync.Mutex
+	calls []FakeCall
+
+	watchersMu sync.Mutex
+	watchers   map[string][]*fakeWatcher // by signal name
+}
+
+type fakeWatcher struct {
+	mu      sync.Mutex // held while sending
+	stopped bool
+	send    func(s interface{})
+}
+
+// recorded returns all calls recorded so far in order they've been made.
+func (f *fake) recorded() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+func (f *fake) record(method string, args ...interface{}) {
+	f.mu.Lock()
+	f.calls = append(f.calls, FakeCall{Method: method, Args: args})
+	f.mu.Unlock()
+}
+
+// watch registers send for signals of the named member until ctx is done,
+// stop is called after that when no signals are being sent.
+func (f *fake) watch(ctx context.Context, member string, send func(s interface{}), stop func()) {
+	w := &fakeWatcher{send: send}
+	f.watchersMu.Lock()
+	if f.watchers == nil {
+		f.watchers = map[string][]*fakeWatcher{}
+	}
+	f.watchers[member] = append(f.watchers[member], w)
+	f.watchersMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		f.watchersMu.Lock()
+		watchers := f.watchers[member]
+		for i := range watchers {
+			if watchers[i] == w {
+				f.watchers[member] = append(watchers[:i:i], watchers[i+1:]...)
+				break
+			}
+		}
+		f.watchersMu.Unlock()
+
+		// wait for the emitter that may have copied w
+		w.mu.Lock()
+		w.stopped = true
+		w.mu.Unlock()
+		stop()
+	}()
+}
+
+// emit sends s to all watchers of the named member, the watchers list
+// is copied so they can watch and emit signals while receiving them.
+func (f *fake) emit(member string, s interface{}) {
+	f.watchersMu.Lock()
+	watchers := append([]*fakeWatcher(nil), f.watchers[member]...)
+	f.watchersMu.Unlock()
+	for _, w := range watchers {
+		w.mu.Lock()
+		if !w.stopped {
+			w.send(s)
+		}
+		w.mu.Unlock()
+	}
+}
+{{end}}
+
+{{- define "fake"}}{{$iface := .Interface}}{{$ := .Context}}{{import "context"}}
+// {{clientType $iface}} is a client of {{$iface.Name}} interface
+// implemented by both *{{ifaceType $iface}} and *{{fakeType $iface}}.
+type {{clientType $iface}} interface {
+{{- range $method := $iface.Methods}}
+	{{methodType $method}}(ctx context.Context, {{joinMethodInArgs $method}}) ({{joinMethodOutArgs $method}}err error)
+{{- end}}
+{{- range $prop := $iface.Properties}}
+{{- if propNeedsGet $iface $prop}}
+	{{propGetType $prop}}(ctx context.Context) ({{propArgName $prop}} {{argType $prop.Arg}}, err error)
+{{- end}}
+{{- if propNeedsSet $iface $prop}}
+	{{propSetType $prop}}(ctx context.Context, {{propArgName $prop}} {{argType $prop.Arg}}) error
+{{- end}}
+{{- end}}
+{{- if and (haveReadableProperties $iface) (getAllNeeded $iface)}}
+	GetAllProperties(ctx context.Context) (*{{propertiesType $iface}}, error)
+{{- end}}
+{{- range $signal := $iface.Signals}}
+	{{clientWatchType $signal}}(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *{{signalType $iface $signal}}, error)
+{{- end}}
+}
+
+var (
+	_ {{clientType $iface}} = (*{{ifaceType $iface}})(nil)
+	_ {{clientType $iface}} = (*{{fakeType $iface}})(nil)
+)
+
+// {{fakeType $iface}} is an in-memory implementation of {{clientType $iface}} for tests,
+// methods call the corresponding Func fields and return zero values when they're nil,
+// all calls are recorded. The zero value is ready to use.
+type {{fakeType $iface}} struct {
+	fake
+{{range $method := $iface.Methods}}
+	{{fakeFunc $iface (methodType $method)}} func(ctx context.Context, {{joinMethodInArgs $method}}) ({{joinMethodOutArgs $method}}err error)
+{{- end}}
+{{- range $prop := $iface.Properties}}
+{{- if propNeedsGet $iface $prop}}
+	{{fakeFunc $iface (propGetType $prop)}} func(ctx context.Context) ({{propArgName $prop}} {{argType $prop.Arg}}, err error)
+{{- end}}
+{{- if propNeedsSet $iface $prop}}
+	{{fakeFunc $iface (propSetType $prop)}} func(ctx context.Context, {{propArgName $prop}} {{argType $prop.Arg}}) error
+{{- end}}
+{{- end}}
+{{- if and (haveReadableProperties $iface) (getAllNeeded $iface)}}
+
+	// {{fakeFunc $iface "GetAllProperties"}} overrides GetAllProperties that
+	// otherwise collects values returned by getter Func fields.
+	{{fakeFunc $iface "GetAllProperties"}} func(ctx context.Context) (*{{propertiesType $iface}}, error)
+{{- end}}
+}
+
+// {{fakeCallsType $iface}} returns all calls recorded so far in order they've been made.
+func (f *{{fakeType $iface}}) {{fakeCallsType $iface}}() []FakeCall {
+	return f.recorded()
+}
+{{range $method := $iface.Methods}}{{$func := fakeFunc $iface (methodType $method)}}
+// {{methodType $method}} records the call and calls {{$func}}.
+func (f *{{fakeType $iface}}) {{methodType $method}}(ctx context.Context, {{joinMethodInArgs $method}}) ({{joinMethodOutArgs $method}}err error) {
+	f.record("{{methodType $method}}", {{joinArgNames $method.In}})
+	if f.{{$func}} != nil {
+		return f.{{$func}}(ctx, {{joinArgNames $method.In}})
+	}
+	return
+}
+{{end}}
+{{- range $prop := $iface.Properties}}
+{{- if propNeedsGet $iface $prop}}{{$func := fakeFunc $iface (propGetType $prop)}}
+// {{propGetType $prop}} records the call and calls {{$func}}.
+func (f *{{fakeType $iface}}) {{propGetType $prop}}(ctx context.Context) ({{propArgName $prop}} {{argType $prop.Arg}}, err error) {
+	f.record("{{propGetType $prop}}")
+	if f.{{$func}} != nil {
+		return f.{{$func}}(ctx)
+	}
+	return
+}
+{{end}}
+{{- if propNeedsSet $iface $prop}}{{$func := fakeFunc $iface (propSetType $prop)}}
+// {{propSetType $prop}} records the call and calls {{$func}}.
+func (f *{{fakeType $iface}}) {{propSetType $prop}}(ctx context.Context, {{propArgName $prop}} {{argType $prop.Arg}}) error {
+	f.record("{{propSetType $prop}}", {{propArgName $prop}})
+	if f.{{$func}} != nil {
+		return f.{{$func}}(ctx, {{propArgName $prop}})
+	}
+	return nil
+}
+{{end}}
+{{- end}}
+{{- if and (haveReadableProperties $iface) (getAllNeeded $iface)}}{{$func := fakeFunc $iface "GetAllProperties"}}
+// GetAllProperties records the call and calls {{$func}},
+// when it's nil values are collected from getter Func fields that are set.
+func (f *{{fakeType $iface}}) GetAllProperties(ctx context.Context) (*{{propertiesType $iface}}, error) {
+	f.record("GetAllProperties")
+	if f.{{$func}} != nil {
+		return f.{{$func}}(ctx)
+	}
+	p := &{{propertiesType $iface}}{}
+{{- range $prop := $iface.Properties}}
+{{- if propNeedsGet $iface $prop}}{{$func := fakeFunc $iface (propGetType $prop)}}
+	if f.{{$func}} != nil {
+		v, err := f.{{$func}}(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.{{propType $prop}} = v
+	}
+{{- end}}
+{{- end}}
+	return p, nil
+}
+{{end}}
+{{- range $signal := $iface.Signals}}{{import "github.com/godbus/dbus/v5"}}
+// {{clientWatchType $signal}} returns a channel receiving {{$iface.Name}}.{{$signal.Name}} signals
+// passed to {{fakeEmitType $signal}}, it's closed when ctx is done, conn and opts are ignored.
+func (f *{{fakeType $iface}}) {{clientWatchType $signal}}(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *{{signalType $iface $signal}}, error) {
+	ch := make(chan *{{signalType $iface $signal}})
+	f.watch(ctx, "{{$signal.Name}}", func(s interface{}) {
+		select {
+		case ch <- s.(*{{signalType $iface $signal}}):
+		case <-ctx.Done():
+		}
+	}, func() {
+		close(ch)
+	})
+	return ch, nil
+}
+
+// {{fakeEmitType $signal}} injects the signal, it blocks until all channels
+// returned by {{clientWatchType $signal}} receive it or their contexts are done.
+func (f *{{fakeType $iface}}) {{fakeEmitType $signal}}(s *{{signalType $iface $signal}}) {
+	f.emit("{{$signal.Name}}", s)
+}
+{{end}}
+{{- end}}`
@@ -0,0 +1,289 @@
+package printer
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amenzhinsky/dbus-codegen-go/parser"
+)
+
+var updateFlag = flag.Bool("update", false, "update golden files in testdata/golden")
+
+// goldenOptions are option combinations all inputs are printed with,
+// prefixes are chosen by the input file name, see goldenPrefix.
+var goldenOptions = []struct {
+	name string
+	opts func(prefix string) []PrintOption
+}{
+	{"default", func(string) []PrintOption {
+		return nil
+	}},
+	{"camelize", func(string) []PrintOption {
+		return []PrintOption{WithCamelize(true)}
+	}},
+	{"idiomatic", func(string) []PrintOption {
+		return []PrintOption{WithIdiomatic(true)}
+	}},
+	{"server-only", func(string) []PrintOption {
+		return []PrintOption{WithServerOnly(true)}
+	}},
+	{"client-only", func(string) []PrintOption {
+		return []PrintOption{WithClientOnly(true)}
+	}},
+	{"prefixes", func(prefix string) []PrintOption {
+		return []PrintOption{WithPrefixes([]string{prefix})}
+	}},
+	{"fakes", func(string) []PrintOption {
+		return []PrintOption{WithFakes(true)}
+	}},
+	{"server-context", func(string) []PrintOption {
+		return []PrintOption{WithServerContext(true)}
+	}},
+	{"types", func(string) []PrintOption {
+		return []PrintOption{WithTypes(map[string]*TypeMapping{
+			"x":                        {Type: "time.Duration", Decode: "durationFromUsec", Encode: "durationToUsec"},
+			"(iu)":                     {Type: "image.Point", Decode: "pointFromStruct", Encode: "pointToStruct"},
+			"org.example.Test.Echo.in": {Type: "net.IP", Decode: "parseIP", Encode: "formatIP"},
+		})}
+	}},
+}
+
+// TestGolden compares printed integration tests inputs with
+// committed output, run `go test -run TestGolden -update`
+// to refresh it after changing templates.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "tests", "testdata", "*.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no inputs found")
+	}
+	goldens := map[string]bool{}
+	for _, file := range files {
+		base := strings.TrimSuffix(filepath.Base(file), ".xml")
+		for _, o := range goldenOptions {
+			goldens[filepath.Join("testdata", "golden", base+"."+o.name+".golden")] = true
+		}
+	}
+	t.Run("stale", func(t *testing.T) {
+		if *updateFlag {
+			return
+		}
+		stale, err := filepath.Glob(filepath.Join("testdata", "golden", "*.golden"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range stale {
+			if !goldens[path] {
+				t.Errorf("%s doesn't have an input, remove it", path)
+			}
+		}
+	})
+
+	for _, file := range files {
+		file, base := file, strings.TrimSuffix(filepath.Base(file), ".xml")
+		t.Run(base, func(t *testing.T) {
+			t.Parallel()
+			b, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ifaces, err := parser.Parse(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, o := range goldenOptions {
+				var buf bytes.Buffer
+				if err = Print(&buf, ifaces, o.opts(goldenPrefix(base))...); err != nil {
+					t.Errorf("%s: %s", o.name, err)
+					continue
+				}
+				checkGolden(t, filepath.Join("testdata", "golden", base+"."+o.name+".golden"), buf.Bytes())
+			}
+		})
+	}
+}
+
+// goldenPrefix returns the first two components of the named file,
+// e.g. org.freedesktop for org.freedesktop.NetworkManager.
+func goldenPrefix(name string) string {
+	if chunks := strings.SplitN(name, ".", 3); len(chunks) == 3 {
+		return chunks[0] + "." + chunks[1]
+	}
+	return name
+}
+
+// checkGolden reports differences between have and the golden
+// file contents in unified format or overwrites it in update mode.
+func checkGolden(t *testing.T, path string, have []byte) {
+	t.Helper()
+	if *updateFlag {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, have, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s, run with -update to create it", err)
+	}
+	if bytes.Equal(have, want) {
+		return
+	}
+	t.Errorf("%s differs, run with -update to accept changes\n%s", path,
+		unifiedDiff(strings.Split(string(want), "\n"), strings.Split(string(have), "\n"), 3))
+}
+
+// unifiedDiff returns all hunks of changes turning a into b
+// with n lines of context around them.
+func unifiedDiff(a, b []string, n int) string {
+	// the common prefix and suffix don't take part in matching
+	var pre, suf int
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ops := make([]byte, 0, len(a)+len(b))
+	for i := 0; i < pre; i++ {
+		ops = append(ops, ' ')
+	}
+	ops = append(ops, diffOps(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for i := 0; i < suf; i++ {
+		ops = append(ops, ' ')
+	}
+
+	var sb strings.Builder
+	var i, j int // positions in a and b
+	for k := 0; k < len(ops); {
+		if ops[k] == ' ' {
+			k, i, j = k+1, i+1, j+1
+			continue
+		}
+		// extend the hunk while changes are close enough
+		start := k - n
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(ops) {
+			if ops[end] != ' ' {
+				end++
+				continue
+			}
+			m := end
+			for m < len(ops) && ops[m] == ' ' {
+				m++
+			}
+			if m == len(ops) || m-end > 2*n {
+				break
+			}
+			end = m
+		}
+		if end += n; end > len(ops) {
+			end = len(ops)
+		}
+		ai, bj := i-(k-start), j-(k-start)
+		var lines []string
+		var al, bl int
+		for _, op := range ops[start:end] {
+			switch op {
+			case ' ':
+				lines = append(lines, " "+a[ai+al])
+				al++
+				bl++
+			case '-':
+				lines = append(lines, "-"+a[ai+al])
+				al++
+			case '+':
+				lines = append(lines, "+"+b[bj+bl])
+				bl++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n%s\n", ai+1, al, bj+1, bl, strings.Join(lines, "\n"))
+		k, i, j = end, ai+al, bj+bl
+	}
+	return sb.String()
+}
+
+// diffOps returns a shortest edit script turning a into b consisting
+// of ' ', '-' and '+' operations, lines are matched with the longest
+// common subsequence, too big inputs are replaced entirely.
+func diffOps(a, b []string) []byte {
+	ops := make([]byte, 0, len(a)+len(b))
+	if len(a)*len(b) > 1<<22 {
+		for range a {
+			ops = append(ops, '-')
+		}
+		for range b {
+			ops = append(ops, '+')
+		}
+		return ops
+	}
+	// lcs[i][j] is the common subsequence length of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var i, j int
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, ' ')
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, '-')
+			i++
+		default:
+			ops = append(ops, '+')
+			j++
+		}
+	}
+	return ops
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Split("a b c d e f g h i j k l m", " ")
+	b := strings.Split("a B c d e f g h i j l m n", " ")
+	want := `@@ -1,4 +1,4 @@
+ a
+-b
++B
+ c
+ d
+@@ -9,5 +9,5 @@
+ i
+ j
+-k
+ l
+ m
++n
+`
+	if have := unifiedDiff(a, b, 2); have != want {
+		t.Errorf("unifiedDiff =\n%s\nwant\n%s", have, want)
+	}
+}
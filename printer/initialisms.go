@@ -0,0 +1,155 @@
+package printer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amenzhinsky/dbus-codegen-go/token"
+)
+
+// defaultInitialisms are spelled as given in idiomatic names regardless
+// of their case in D-Bus names, mostly the ones recognized by golint.
+var defaultInitialisms = []string{
+	"ACL", "API", "ASCII", "CPU", "CSS", "DBus", "DNS", "EOF", "GUID",
+	"HTML", "HTTP", "HTTPS", "ID", "IP", "IPv4", "IPv6", "JSON", "LHS",
+	"QPS", "RAM", "RHS", "RPC", "SLA", "SMTP", "SQL", "SSH", "TCP", "TLS",
+	"TTL", "UDP", "UI", "UID", "UUID", "URI", "URL", "UTF8", "VM", "XML",
+	"XMPP", "XSRF", "XSS",
+}
+
+// initialismTable returns default and the given initialisms longest first,
+// the given ones override spelling of default ones that differ only in case.
+func initialismTable(extra []string) ([]string, error) {
+	byKey := map[string]string{}
+	for _, list := range [][]string{defaultInitialisms, extra} {
+		for _, s := range list {
+			if !isAlnum(s) {
+				return nil, fmt.Errorf("initialism %q is not valid", s)
+			}
+			byKey[strings.ToLower(s)] = s
+		}
+	}
+	table := make([]string, 0, len(byKey))
+	for _, s := range byKey {
+		table = append(table, s)
+	}
+	sort.Slice(table, func(i, j int) bool {
+		if len(table[i]) != len(table[j]) {
+			return len(table[i]) > len(table[j])
+		}
+		return table[i] < table[j]
+	})
+	return table, nil
+}
+
+func isAlnum(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isLetter(s[i]) && !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+func isUpper(c byte) bool  { return c >= 'A' && c <= 'Z' }
+func isLower(c byte) bool  { return c >= 'a' && c <= 'z' }
+
+// idiomaticName converts name into a camel case identifier following
+// Go conventions, words are separated by characters that cannot be used
+// in identifiers, underscores and case changes, words matching initialisms
+// (optionally followed by a plural s) are spelled as initialisms,
+// e.g. "ip4_config" is "IP4Config" and "GetDeviceIds" is "GetDeviceIDs".
+// The first word is lowercased unless export is true.
+func (ctx *context) idiomaticName(name string, export bool) string {
+	s := identifier(name)
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] == '_' {
+			i++
+			continue
+		}
+		first := b.Len() == 0
+		if word, n := ctx.matchInitialism(s, i); n != 0 {
+			if first && !export {
+				word = strings.ToLower(word)
+			}
+			b.WriteString(word)
+			i += n
+			continue
+		}
+		j := i + 1
+		for j < len(s) && !isWordStart(s, j) {
+			j++
+		}
+		switch word := s[i:j]; {
+		case first && !export && strings.ToUpper(word) == word:
+			b.WriteString(strings.ToLower(word)) // e.g. PID
+		case first && !export:
+			b.WriteString(strings.ToLower(word[:1]) + word[1:])
+		default:
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// matchInitialism returns the initialism found at the beginning of the word
+// starting at i in s and the number of bytes it takes, a plural s is kept.
+func (ctx *context) matchInitialism(s string, i int) (string, int) {
+	for _, word := range ctx.initialisms {
+		n := len(word)
+		if i+n > len(s) || !strings.EqualFold(s[i:i+n], word) {
+			continue
+		}
+		if isWordEnd(s, i+n) {
+			return word, n
+		}
+		if s[i+n] == 's' && isWordEnd(s, i+n+1) {
+			return word + "s", n + 1
+		}
+	}
+	return "", 0
+}
+
+// isWordStart reports whether a new word starts at i in an identifier s.
+func isWordStart(s string, i int) bool {
+	switch {
+	case i == 0 || s[i-1] == '_' || s[i] == '_':
+		return true
+	case isDigit(s[i]):
+		return !isDigit(s[i-1])
+	case isUpper(s[i]) && (isLower(s[i-1]) || isDigit(s[i-1])):
+		return true
+	case isUpper(s[i]) && isUpper(s[i-1]):
+		// the last capital of an acronym starts the next word, e.g. HTTPServer
+		return i+1 < len(s) && isLower(s[i+1])
+	}
+	return false
+}
+
+// isWordEnd reports whether a word ending at i in s can end there,
+// that's true when the next character is not a lowercase letter.
+func isWordEnd(s string, i int) bool {
+	return i == len(s) || !isLower(s[i])
+}
+
+// idiomaticArgName is argName in the idiomatic mode, keywords and names
+// starting with a digit are prefixed, e.g. "type" becomes "inType".
+func (ctx *context) idiomaticArgName(arg *token.Arg, prefix string, i int, export bool) string {
+	name := ctx.idiomaticName(arg.Name, export)
+	switch {
+	case name == "":
+		name = ctx.idiomaticName(prefix+strconv.Itoa(i), export)
+	case isKeyword(name) || isDigit(name[0]):
+		name = ctx.idiomaticName(prefix+"_"+name, export)
+	}
+	return name
+}
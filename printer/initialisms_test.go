@@ -0,0 +1,88 @@
+package printer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/amenzhinsky/dbus-codegen-go/parser"
+)
+
+func TestIdiomaticName(t *testing.T) {
+	ctx := &context{idiomatic: true}
+	var err error
+	if ctx.initialisms, err = initialismTable([]string{"DHCP", "Dbus"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name   string
+		export bool
+		want   string
+	}{
+		{"org.freedesktop.DBus", true, "OrgFreedesktopDbus"},
+		{"org.freedesktop.NetworkManager.IP4Config", true, "OrgFreedesktopNetworkManagerIP4Config"},
+		{"GetConnectionByUuid", true, "GetConnectionByUUID"},
+		{"GetId", true, "GetID"},
+		{"Identity", true, "Identity"},
+		{"DeviceIds", true, "DeviceIDs"},
+		{"Ipv4Address", true, "IPv4Address"},
+		{"Dhcp4Config", true, "DHCP4Config"},
+		{"HTTPServer", true, "HTTPServer"},
+		{"set_url_list", true, "SetURLList"},
+		{"Uint32Value", true, "Uint32Value"},
+		{"uuid", false, "uuid"},
+		{"UrlPath", false, "urlPath"},
+		{"PIDFile", false, "pidFile"},
+		{"object_path", false, "objectPath"},
+		{"2nd", false, "2nd"},
+	} {
+		if have := ctx.idiomaticName(test.name, test.export); have != test.want {
+			t.Errorf("idiomaticName(%q, %t) = %q, want %q", test.name, test.export, have, test.want)
+		}
+	}
+}
+
+func TestInitialismsError(t *testing.T) {
+	ifaces, err := parser.Parse([]byte(`<node><interface name="org.example.Foo"/></node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = Print(&buf, ifaces, WithIdiomatic(true), WithInitialisms([]string{"TCP/IP"}))
+	if err == nil || err.Error() != `initialism "TCP/IP" is not valid` {
+		t.Errorf("Print error = %v, want an invalid initialism error", err)
+	}
+}
+
+func TestPrintIdiomatic(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.freedesktop.DBus.Example">
+		<method name="GetConnectionByUuid">
+			<arg name="uuid" type="s" direction="in"/>
+			<arg name="connection_id" type="(su)" direction="out"/>
+		</method>
+		<signal name="IdChanged">
+			<arg name="new_id" type="s"/>
+		</signal>
+		<property name="Ip4Address" type="u" access="read"/>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = Print(&buf, ifaces, WithIdiomatic(true), WithStructFields(map[string][]string{
+		"(su)": {"url", "user_id"},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	checkDeclarations(t, buf.Bytes(), map[string]string{
+		"OrgFreedesktopDBusExample.GetConnectionByUUID":           "func(ctx context.Context, uuid string) (connectionID OrgFreedesktopDBusExampleGetConnectionByUUIDOut0, err error)",
+		"OrgFreedesktopDBusExampleGetConnectionByUUIDOut0.URL":    "string",
+		"OrgFreedesktopDBusExampleGetConnectionByUUIDOut0.UserID": "uint32",
+		"OrgFreedesktopDBusExampleIDChangedSignal":                "struct",
+		"OrgFreedesktopDBusExampleIDChangedSignalBody.NewID":      "string",
+		"OrgFreedesktopDBusExample.GetIP4Address":                 "func(ctx context.Context) (ip4Address uint32, err error)",
+	})
+}
@@ -0,0 +1,106 @@
+package printer
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+
+	"github.com/amenzhinsky/dbus-codegen-go/token"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+func (ctx *context) tplIfaceXMLConst(iface *token.Interface) string {
+	return "introspection" + ctx.tplIfaceType(iface)
+}
+
+// tplIfaceXML returns go literal of the interface's introspection data
+// suitable for embedding into the node document served by exported objects.
+func (ctx *context) tplIfaceXML(iface *token.Interface) (string, error) {
+	var b strings.Builder
+	enc := xml.NewEncoder(&b)
+	enc.Indent("\t", "\t")
+	if err := enc.EncodeElement(introspectIface(iface), xml.StartElement{
+		Name: xml.Name{Local: "interface"},
+	}); err != nil {
+		return "", err
+	}
+	s := b.String() + "\n"
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s), nil
+	}
+	return "`" + s + "`", nil
+}
+
+// introspectIface converts the interface back to the introspection format.
+func introspectIface(iface *token.Interface) *introspect.Interface {
+	v := &introspect.Interface{
+		Name:        iface.Name,
+		Annotations: introspectAnnotations(iface.Annotations),
+	}
+	for _, method := range iface.Methods {
+		m := introspect.Method{
+			Name:        method.Name,
+			Annotations: introspectAnnotations(method.Annotations),
+		}
+		if len(method.Args) != 0 {
+			for _, arg := range method.Args {
+				m.Args = append(m.Args, introspectArg(arg, arg.Direction))
+			}
+		} else {
+			// methods that aren't parsed have inputs first
+			for _, arg := range method.In {
+				m.Args = append(m.Args, introspectArg(arg, "in"))
+			}
+			for _, arg := range method.Out {
+				m.Args = append(m.Args, introspectArg(arg, "out"))
+			}
+		}
+		v.Methods = append(v.Methods, m)
+	}
+	for _, signal := range iface.Signals {
+		s := introspect.Signal{
+			Name:        signal.Name,
+			Annotations: introspectAnnotations(signal.Annotations),
+		}
+		for _, arg := range signal.Args {
+			s.Args = append(s.Args, introspectArg(arg, ""))
+		}
+		v.Signals = append(v.Signals, s)
+	}
+	for _, prop := range iface.Properties {
+		p := introspect.Property{
+			Name:        prop.Name,
+			Type:        prop.Arg.Type.Signature,
+			Annotations: introspectAnnotations(prop.Annotations),
+		}
+		switch {
+		case prop.Read && prop.Write:
+			p.Access = "readwrite"
+		case prop.Write:
+			p.Access = "write"
+		default:
+			p.Access = "read"
+		}
+		v.Properties = append(v.Properties, p)
+	}
+	return v
+}
+
+func introspectArg(arg *token.Arg, direction string) introspect.Arg {
+	return introspect.Arg{
+		Name:      arg.Name,
+		Type:      arg.Type.Signature,
+		Direction: direction,
+	}
+}
+
+func introspectAnnotations(annotations []*token.Annotation) []introspect.Annotation {
+	v := make([]introspect.Annotation, 0, len(annotations))
+	for _, annotation := range annotations {
+		v = append(v, introspect.Annotation{
+			Name:  annotation.Name,
+			Value: annotation.Value,
+		})
+	}
+	return v
+}
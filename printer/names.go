@@ -0,0 +1,573 @@
+package printer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/amenzhinsky/dbus-codegen-go/token"
+)
+
+// runtimeImports are import paths of packages used by generated code
+// by their names, generated names never use them.
+var runtimeImports = map[string]string{
+	"context": "context",
+	"dbus":    "github.com/godbus/dbus/v5",
+	"errors":  "errors",
+	"fmt":     "fmt",
+	"sort":    "sort",
+	"strings": "strings",
+	"sync":    "sync",
+}
+
+// runtimeNames are package-level identifiers of code shared by all
+// interfaces, generated names never use them.
+var runtimeNames = []string{
+	// common and client code
+	"Signal", "Emit", "ErrUnknownSignal", "LookupSignal", "AddMatchSignal",
+	"RemoveMatchSignal", "WatchOption", "WithWatchPath", "WithWatchPathNamespace",
+	"WithWatchSender", "withWatchArg0", "watcher", "busName", "newWatcher", "watch",
+	"SignalDispatcher", "signalHandler", "NewSignalDispatcher",
+	"ManagedObject", "GetManagedObjects", "ObjectCache", "NewObjectCache",
+	// ManagedObject members sharing its namespace with fields
+	// named after interface types and their snapshots
+	"Path", "Interfaces", "Implements", "withInterfaces", "withoutInterfaces",
+	"FakeCall", "fake", "fakeWatcher",
+
+	// server code
+	"ErrUnknownObject", "ErrUnknownInterface", "ErrUnknownProperty", "ErrPropertyReadOnly",
+	"ErrPropertyWriteOnly", "exportedIface", "exportedProperty", "CallInfo",
+	"callInfoKey", "CallInfoFromContext", "newCallContext", "exports", "trackConn", "releaseConn",
+	"ifacePeer", "ifaceIntrospectable", "ifaceProperties", "ifaceObjectManager",
+	"headerXML", "propertiesXML", "objectManagerXML",
+	"exportIface", "registerIface", "unexportIface", "unregisterIface",
+	"hasProperties", "introspectPath", "checkObjectPath", "lookupProperty", "getProperty",
+	"getAllProperties", "ServeObjectManager", "StopObjectManager", "managerOf",
+	"isDescendant", "getManagedObjects", "emitPropertiesChanged", "storeProperty",
+	"invalidArgs",
+}
+
+// Names of parameters, receivers and package-level identifiers used by
+// generated functions taking arguments and imported packages that
+// arguments are renamed not to shadow.
+var (
+	methodParams = []string{"ctx", "err", "o", "f", "v", "msg",
+		"newCallContext", "context", "dbus", "errors", "fmt"}
+	propParams = []string{"ctx", "err", "o", "f", "conn", "path",
+		"emitPropertiesChanged", "context", "dbus", "errors", "fmt"}
+
+	// mappedParams are additionally used by methods with mapped arguments.
+	mappedParams = []string{"convErr", "invalidArgs"}
+
+	// clientFields are fields of clients that their methods must not use.
+	clientFields = []string{"object"}
+
+	// fakeMembers are fields and methods promoted to fakes from
+	// the embedded fake runtime, its type name is the field name.
+	fakeMembers = []string{"fake", "mu", "calls", "watchersMu", "watchers",
+		"recorded", "record", "watch", "emit"}
+
+	// methodMembers are members of clients, unimplemented servers and
+	// fakes that aren't named after methods, only explicit names use them.
+	methodMembers = append(append([]string{"iface"}, clientFields...), fakeMembers...)
+
+	// propMembers are members of properties snapshots
+	// that aren't named after properties.
+	propMembers = []string{"decode"}
+)
+
+// identifier makes name usable as an ASCII identifier, non-ASCII letters
+// and digits are replaced with their code points the same way as in Go
+// escapes, e.g. "ü" becomes "U00FC", other characters that cannot be used
+// in identifiers separate words, e.g. "foo-bar" becomes "fooBar".
+func identifier(name string) string {
+	var b strings.Builder
+	var upper bool
+	for _, r := range name {
+		if r >= utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if r > 0xFFFF {
+				fmt.Fprintf(&b, "U%08X", r)
+			} else {
+				fmt.Fprintf(&b, "U%04X", r)
+			}
+			upper = false
+			continue
+		}
+		if r >= utf8.RuneSelf || r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = b.Len() != 0
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// memberName returns the exported name of a method, property or signal,
+// names that cannot be exported are prefixed with X, e.g. "_foo" is "X_foo".
+func (ctx *context) memberName(name string) string {
+	if ctx.idiomatic {
+		name = ctx.idiomaticName(name, true)
+	} else {
+		name = strings.Title(identifier(name))
+	}
+	if name == "" || !unicode.IsUpper(rune(name[0])) {
+		return "X" + name
+	}
+	return name
+}
+
+// symbols is a table of package-level identifiers mapped to descriptions
+// of D-Bus entities they're generated for, used to detect conflicts.
+type symbols map[string]string
+
+// claim registers all the given names for the owner unless any of them is taken,
+// in that case it returns a description of the conflicting entity.
+func (s symbols) claim(owner string, names ...string) (string, bool) {
+	for i, name := range names {
+		if taken, ok := s[name]; ok {
+			return taken, false
+		}
+		for _, prev := range names[:i] {
+			if prev == name {
+				return owner, false
+			}
+		}
+	}
+	for _, name := range names {
+		s[name] = owner
+	}
+	return "", true
+}
+
+// claimSuffixed claims names generated by fn for the owner, when they
+// conflict with already registered ones fn is called with increasing
+// numeric suffixes starting from 2 until it succeeds, unless explicit
+// is true meaning that names are given by the user, then it fails.
+func (s symbols) claimSuffixed(owner string, explicit bool, fn func(suffix string) []string) (string, error) {
+	taken, ok := s.claim(owner, fn("")...)
+	if ok {
+		return "", nil
+	}
+	if explicit {
+		return "", fmt.Errorf("%s conflicts with %s", owner, taken)
+	}
+	for i := 2; ; i++ {
+		suffix := strconv.Itoa(i)
+		if _, ok = s.claim(owner, fn(suffix)...); ok {
+			return suffix, nil
+		}
+	}
+}
+
+// annotationName gives a Go name to the annotated interface, method,
+// property or signal, suffixed with In<N> or Out<N> it names an argument
+// of the annotated method or signal, e.g. org.golang.Name.Out0.
+const annotationName = "org.golang.Name"
+
+// resolveNames names interfaces and their members making sure generated
+// identifiers don't conflict. Names given explicitly with the names option
+// or annotations are claimed first and conflicts between them are errors,
+// then generated names are claimed in the given order, interfaces first,
+// getting numeric suffixes on conflicts.
+func (ctx *context) resolveNames() error {
+	ctx.symbols = reserved(runtimeNames)
+	for name := range runtimeImports {
+		ctx.symbols[name] = "generated code"
+	}
+	pkgs := make([]string, 0, len(ctx.typeImports))
+	for pkg := range ctx.typeImports {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		path := ctx.typeImports[pkg]
+		if runtimeImports[pkg] == path {
+			continue
+		}
+		if _, err := ctx.symbols.claimSuffixed(path+" package", true, func(string) []string {
+			return []string{pkg}
+		}); err != nil {
+			return err
+		}
+	}
+
+	ctx.ifaceTypes = map[*token.Interface]string{}
+	for _, explicit := range []bool{true, false} {
+		for _, iface := range ctx.Interfaces {
+			name, ok, err := ctx.explicitName(iface.Name, iface.Annotations, "")
+			if err != nil {
+				return err
+			}
+			if ok != explicit {
+				continue
+			}
+			if !ok {
+				name = ctx.ifaceTypeName(iface)
+			}
+			suffix, err := ctx.symbols.claimSuffixed(iface.Name+" interface", explicit,
+				func(suffix string) []string {
+					return ctx.ifaceSymbols(name + suffix)
+				},
+			)
+			if err != nil {
+				return err
+			}
+			ctx.ifaceTypes[iface] = name + suffix
+		}
+	}
+
+	ctx.methodNames = map[*token.Method]string{}
+	ctx.propNames = map[*token.Property]string{}
+	ctx.propEmitNames = map[*token.Property]string{}
+	ctx.signalNames = map[*token.Signal]string{}
+	ctx.argNames = map[*token.Arg]string{}
+	ctx.rawNames = map[*token.Arg]string{}
+	methods := map[*token.Interface]symbols{}
+	props := map[*token.Interface]symbols{}
+	for _, iface := range ctx.Interfaces {
+		methods[iface], props[iface] = reserved(methodMembers), reserved(propMembers)
+	}
+	for _, explicit := range []bool{true, false} {
+		for _, iface := range ctx.Interfaces {
+			for _, method := range iface.Methods {
+				if err := ctx.resolveMethod(iface, method, methods[iface], explicit); err != nil {
+					return err
+				}
+			}
+			for _, prop := range iface.Properties {
+				if err := ctx.resolveProperty(iface, prop, props[iface], explicit); err != nil {
+					return err
+				}
+			}
+			for _, signal := range iface.Signals {
+				if err := ctx.resolveSignal(iface, signal, explicit); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	ctx.clientWatchNames = map[*token.Signal]string{}
+	ctx.fakeFuncNames = map[*token.Interface]map[string]string{}
+	ctx.fakeEmitNames = map[*token.Signal]string{}
+	ctx.fakeCallsNames = map[*token.Interface]string{}
+	for _, iface := range ctx.Interfaces {
+		ctx.resolveClient(iface)
+	}
+	return nil
+}
+
+// resolveClient names signal watch methods of the interface's client
+// and members of its fake that aren't named after the client's methods,
+// they get numeric suffixes when they conflict with the client's methods
+// and fields or members promoted from the fake runtime.
+func (ctx *context) resolveClient(iface *token.Interface) {
+	var methods []string
+	for _, method := range iface.Methods {
+		methods = append(methods, ctx.tplMethodType(method))
+	}
+	for _, prop := range iface.Properties {
+		if ctx.tplPropNeedsGet(iface, prop) {
+			methods = append(methods, ctx.tplPropGetType(prop))
+		}
+		if ctx.tplPropNeedsSet(iface, prop) {
+			methods = append(methods, ctx.tplPropSetType(prop))
+		}
+	}
+	if ctx.tplHaveReadableProperties(iface) && ctx.tplGetAllNeeded(iface) {
+		methods = append(methods, "GetAllProperties")
+	}
+
+	client := reserved(clientFields)
+	client.reserve(methods...)
+	fake := reserved(fakeMembers)
+	fake.reserve(methods...)
+	for _, signal := range iface.Signals {
+		name := "Watch" + ctx.signalName(signal)
+		suffix, _ := client.claimSuffixed(iface.Name+"."+signal.Name+" signal", false, func(suffix string) []string {
+			return []string{name + suffix}
+		})
+		ctx.clientWatchNames[signal] = name + suffix
+		fake.reserve(name + suffix)
+	}
+
+	funcs := map[string]string{}
+	for _, method := range methods {
+		suffix, _ := fake.claimSuffixed(method+" method", false, func(suffix string) []string {
+			return []string{method + "Func" + suffix}
+		})
+		funcs[method] = method + "Func" + suffix
+	}
+	ctx.fakeFuncNames[iface] = funcs
+	for _, signal := range iface.Signals {
+		name := "Emit" + ctx.signalName(signal)
+		suffix, _ := fake.claimSuffixed(iface.Name+"."+signal.Name+" signal", false, func(suffix string) []string {
+			return []string{name + suffix}
+		})
+		ctx.fakeEmitNames[signal] = name + suffix
+	}
+	suffix, _ := fake.claimSuffixed("Calls method", false, func(suffix string) []string {
+		return []string{"Calls" + suffix}
+	})
+	ctx.fakeCallsNames[iface] = "Calls" + suffix
+}
+
+// explicitName returns the Go name given to the D-Bus entity identified
+// by key with the names option or annotationName suffixed with suffix.
+func (ctx *context) explicitName(key string, annotations []*token.Annotation, suffix string) (string, bool, error) {
+	name, ok := ctx.names[key]
+	if !ok {
+		name, ok = findAnnotation(annotations, annotationName, suffix)
+	}
+	if ok && (!identRegexp.MatchString(name) || isKeyword(name)) {
+		return "", false, fmt.Errorf("%s: name %q is not a valid identifier", key, name)
+	}
+	return name, ok, nil
+}
+
+// resolveMethod names the method unless explicit doesn't match the way
+// it's named and its arguments, methods contains names of the interface's methods.
+func (ctx *context) resolveMethod(iface *token.Interface, method *token.Method, methods symbols, explicit bool) error {
+	key := iface.Name + "." + method.Name
+	name, ok, err := ctx.explicitName(key, method.Annotations, "")
+	if err != nil || ok != explicit {
+		return err
+	}
+	if !ok {
+		name = ctx.memberName(method.Name)
+	}
+	suffix, err := methods.claimSuffixed(key+" method", explicit, func(suffix string) []string {
+		return []string{name + suffix}
+	})
+	if err != nil {
+		return err
+	}
+	ctx.methodNames[method] = name + suffix
+
+	args := make([]argument, 0, len(method.In)+len(method.Out))
+	for i, arg := range method.In {
+		args = append(args, argument{arg, "in", i, "In" + strconv.Itoa(i)})
+	}
+	for i, arg := range method.Out {
+		args = append(args, argument{arg, "out", i, "Out" + strconv.Itoa(i)})
+	}
+	taken := reserved(methodParams)
+	for _, arg := range args {
+		if m := ctx.argTypes[arg.Arg]; m != nil {
+			taken.reserve(m.idents...)
+			taken.reserve(mappedParams...)
+		}
+	}
+	return ctx.resolveArgs(key, method.Annotations, args, false, taken)
+}
+
+// resolveProperty names the property unless explicit doesn't match the way
+// it's named, props contains names of the interface's properties.
+func (ctx *context) resolveProperty(iface *token.Interface, prop *token.Property, props symbols, explicit bool) error {
+	key := iface.Name + "." + prop.Name
+	name, ok, err := ctx.explicitName(key, prop.Annotations, "")
+	if err != nil || ok != explicit {
+		return err
+	}
+	if !ok {
+		name = ctx.memberName(prop.Name)
+	}
+	suffix, err := props.claimSuffixed(key+" property", explicit, func(suffix string) []string {
+		return []string{name + suffix}
+	})
+	if err != nil {
+		return err
+	}
+	name += suffix
+	ctx.propNames[prop] = name
+
+	emit := "Emit" + ctx.joinTypeName(ctx.ifaceTypes[iface], name+"Changed")
+	if suffix, err = ctx.symbols.claimSuffixed(key+" property", explicit, func(suffix string) []string {
+		return []string{emit + suffix}
+	}); err != nil {
+		return err
+	}
+	ctx.propEmitNames[prop] = emit + suffix
+	taken := reserved(propParams)
+	if m := ctx.argTypes[prop.Arg]; m != nil {
+		taken.reserve(m.idents...)
+	}
+	name = taken.claimArg(key+" property", ctx.argName(prop.Arg, "v", 0, false), "v", 0)
+	ctx.argNames[prop.Arg] = name
+	if ctx.argTypes[prop.Arg] != nil {
+		ctx.rawNames[prop.Arg] = taken.claimArg(key+" property", "raw"+strings.Title(name), "raw", 0)
+	}
+	return nil
+}
+
+// resolveSignal names the signal unless explicit doesn't match
+// the way it's named and its arguments.
+func (ctx *context) resolveSignal(iface *token.Interface, signal *token.Signal, explicit bool) error {
+	key := iface.Name + "." + signal.Name
+	name, ok, err := ctx.explicitName(key, signal.Annotations, "")
+	if err != nil || ok != explicit {
+		return err
+	}
+	if !ok {
+		name = ctx.memberName(signal.Name)
+	}
+	suffix, err := ctx.symbols.claimSuffixed(key+" signal", explicit, func(suffix string) []string {
+		return signalSymbols(ctx.joinTypeName(ctx.ifaceTypes[iface], name+suffix))
+	})
+	if err != nil {
+		return err
+	}
+	ctx.signalNames[signal] = name + suffix
+
+	args := make([]argument, 0, len(signal.Args))
+	for i, arg := range signal.Args {
+		args = append(args, argument{arg, "v", i, signalArgSuffix(signal, i)})
+	}
+	return ctx.resolveArgs(key, signal.Annotations, args, true, symbols{})
+}
+
+// argument is a method or signal argument, prefix is used for naming
+// unnamed arguments and suffix for looking up its annotations.
+type argument struct {
+	*token.Arg
+	prefix string
+	index  int
+	suffix string
+}
+
+// argKey returns the key of the member's argument in names and types
+// options, unnamed arguments are identified by their annotations suffix.
+func argKey(member string, arg *token.Arg, suffix string) string {
+	if arg.Name == "" {
+		return member + "." + suffix
+	}
+	return member + "." + arg.Name
+}
+
+// resolveArgs names arguments of the member identified by key,
+// explicitly named ones first, taken contains names they must not use.
+// Mapped arguments of methods get names of their raw variables too.
+func (ctx *context) resolveArgs(
+	key string, annotations []*token.Annotation, args []argument, export bool, taken symbols,
+) error {
+	for _, explicit := range []bool{true, false} {
+		for _, arg := range args {
+			argKey := argKey(key, arg.Arg, arg.suffix)
+			name, ok, err := ctx.explicitName(argKey, annotations, arg.suffix)
+			if err != nil {
+				return err
+			}
+			if ok != explicit {
+				continue
+			}
+			owner := argKey + " argument"
+			if ok {
+				if _, err = taken.claimSuffixed(owner, true, func(string) []string {
+					return []string{name}
+				}); err != nil {
+					return err
+				}
+			} else {
+				prefix := arg.prefix
+				if export {
+					prefix = strings.Title(prefix)
+				}
+				name = taken.claimArg(owner, ctx.argName(arg.Arg, arg.prefix, arg.index, export), prefix, arg.index)
+			}
+			ctx.argNames[arg.Arg] = name
+		}
+	}
+	if export {
+		return nil
+	}
+	for _, arg := range args {
+		if ctx.argTypes[arg.Arg] != nil {
+			ctx.rawNames[arg.Arg] = taken.claimArg(argKey(key, arg.Arg, arg.suffix)+" argument",
+				"raw"+strings.Title(ctx.argNames[arg.Arg]), "raw", arg.index)
+		}
+	}
+	return nil
+}
+
+// ifaceSymbols returns package-level names generated
+// for an interface with the given type name.
+func (ctx *context) ifaceSymbols(typ string) []string {
+	changes := ctx.joinTypeName(typ, "PropertyChanges")
+	return []string{
+		typ,
+		"New" + typ,
+		typ + "er",
+		"Unimplemented" + typ,
+		"Export" + typ,
+		"Unexport" + typ,
+		"Interface" + typ,
+		"introspection" + typ,
+		ctx.joinTypeName(typ, "Snapshot"),
+		changes,
+		"Parse" + changes,
+		"Watch" + changes,
+		ctx.joinTypeName(typ, "ChangedProperties"),
+		ctx.joinTypeName(typ, "Client"),
+		"Fake" + typ,
+	}
+}
+
+// signalSymbols returns package-level names generated for a signal,
+// base is the signal name joined with its interface type name.
+func signalSymbols(base string) []string {
+	return []string{
+		base + "Signal",
+		base + "SignalBody",
+		"Watch" + base,
+		"On" + base, // SignalDispatcher method
+	}
+}
+
+// reserved returns a symbols table of the given names used by generated code.
+func reserved(list []string) symbols {
+	s := make(symbols, len(list))
+	s.reserve(list...)
+	return s
+}
+
+// reserve registers the given names as used by generated code.
+func (s symbols) reserve(names ...string) {
+	for _, name := range names {
+		s[name] = "generated code"
+	}
+}
+
+// claimArg claims the argument's generated name for the owner, when it's
+// taken the name is prefixed the same way as keywords, e.g. "ctx" becomes
+// "inCtx", then suffixed with the argument's index and a number.
+func (s symbols) claimArg(owner, name, prefix string, i int) string {
+	base := prefix + strings.Title(name)
+	for _, candidate := range []string{name, base, base + strconv.Itoa(i)} {
+		if _, ok := s.claim(owner, candidate); ok {
+			return candidate
+		}
+	}
+	base += strconv.Itoa(i)
+	suffix, _ := s.claimSuffixed(owner, false, func(suffix string) []string {
+		return []string{base + suffix}
+	})
+	return base + suffix
+}
+
+// claimStruct claims the name of a struct type used by the owner,
+// automatically generated names get numeric suffixes on conflicts.
+func (ctx *context) claimStruct(owner string, typ *token.Type, name string, explicit bool) (string, error) {
+	suffix, err := ctx.symbols.claimSuffixed(fmt.Sprintf("%s struct %q", owner, typ.Signature), explicit,
+		func(suffix string) []string {
+			return []string{name + suffix}
+		},
+	)
+	return name + suffix, err
+}
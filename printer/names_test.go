@@ -0,0 +1,577 @@
+package printer
+
+import (
+	"bytes"
+	"go/ast"
+	goparser "go/parser"
+	goprinter "go/printer"
+	gotoken "go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amenzhinsky/dbus-codegen-go/parser"
+)
+
+// TestSymbols checks that all package-level identifiers of generated
+// code are registered in the symbols table so conflicts are detected.
+func TestSymbols(t *testing.T) {
+	t.Parallel()
+
+	files, err := filepath.Glob("../tests/testdata/*.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ifaces, err := parser.Parse(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, naming := range []PrintOption{WithCamelize(false), WithCamelize(true), WithIdiomatic(true)} {
+			opts := []PrintOption{WithFakes(true), WithServerContext(true), naming}
+			ctx, err := newContext(ifaces, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err = Print(&buf, ifaces, opts...); err != nil {
+				t.Fatalf("%s: %s", file, err)
+			}
+			for _, name := range topLevelNames(t, buf.Bytes()) {
+				if _, ok := ctx.symbols[name]; !ok {
+					t.Errorf("%s: %s is not in the symbols table", file, name)
+				}
+			}
+		}
+	}
+}
+
+// TestReservedMembers checks that members of generated types sharing
+// their namespaces with generated names are reserved.
+func TestReservedMembers(t *testing.T) {
+	t.Parallel()
+
+	b, err := os.ReadFile("../tests/testdata/org.example.Names.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifaces, err := parser.Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := newContext(ifaces, WithFakes(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = Print(&buf, ifaces, WithFakes(true)); err != nil {
+		t.Fatal(err)
+	}
+	members := typeMembers(t, buf.Bytes())
+
+	check := func(typ string, list []string, skip map[string]bool) {
+		t.Helper()
+		if len(members[typ]) == 0 {
+			t.Errorf("%s has no members", typ)
+		}
+		for _, name := range members[typ] {
+			if !skip[name] && !contains(list, name) {
+				t.Errorf("%s.%s is not reserved", typ, name)
+			}
+		}
+	}
+	fields := map[string]bool{}
+	for _, iface := range ifaces {
+		fields[ctx.tplIfaceType(iface)] = true
+		fields[ctx.tplPropertiesType(iface)] = true
+	}
+	check("ManagedObject", runtimeNames, fields)
+	check("fake", fakeMembers, nil)
+	for _, iface := range ifaces {
+		// exported members are named after the interface's members
+		exported := map[string]bool{}
+		for _, typ := range []string{ctx.tplIfaceType(iface), ctx.tplUnimplementedType(iface),
+			ctx.tplFakeType(iface), ctx.tplPropertiesType(iface)} {
+			for _, name := range members[typ] {
+				exported[name] = gotoken.IsExported(name)
+			}
+		}
+		for _, typ := range []string{ctx.tplIfaceType(iface), ctx.tplUnimplementedType(iface), ctx.tplFakeType(iface)} {
+			check(typ, methodMembers, exported)
+		}
+		if ctx.tplHaveReadableProperties(iface) {
+			check(ctx.tplPropertiesType(iface), propMembers, exported)
+		}
+	}
+}
+
+// TestReservedNames checks that explicit names can't use
+// identifiers emitted by objects and fakes runtimes.
+func TestReservedNames(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Foo">
+		<method name="Bar"/>
+		<property name="Baz" type="s" access="read"/>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type test struct{ key, name, error string }
+	var tests []test
+	for _, name := range []string{
+		"ManagedObject", "GetManagedObjects", "ObjectCache", "NewObjectCache",
+		"Path", "Interfaces", "Implements", "withInterfaces", "withoutInterfaces",
+		"FakeCall", "fake", "fakeWatcher",
+	} {
+		tests = append(tests, test{
+			"org.example.Foo", name, "org.example.Foo interface conflicts with generated code",
+		})
+	}
+	for _, name := range methodMembers {
+		tests = append(tests, test{
+			"org.example.Foo.Bar", name, "org.example.Foo.Bar method conflicts with generated code",
+		})
+	}
+	for _, name := range propMembers {
+		tests = append(tests, test{
+			"org.example.Foo.Baz", name, "org.example.Foo.Baz property conflicts with generated code",
+		})
+	}
+	for _, tc := range tests {
+		_, err := newContext(ifaces, WithFakes(true), WithNames(map[string]string{tc.key: tc.name}))
+		if err == nil || err.Error() != tc.error {
+			t.Errorf("%s=%s: error = %v, want %q", tc.key, tc.name, err, tc.error)
+		}
+	}
+}
+
+// typeMembers returns names of fields and methods by type names.
+func typeMembers(t *testing.T, src []byte) map[string][]string {
+	t.Helper()
+	f, err := goparser.ParseFile(gotoken.NewFileSet(), "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := map[string][]string{}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				continue
+			}
+			typ := decl.Recv.List[0].Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			name := typ.(*ast.Ident).Name
+			members[name] = append(members[name], decl.Name.Name)
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				spec, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				st, ok := spec.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				for _, field := range st.Fields.List {
+					if len(field.Names) == 0 { // embedded
+						members[spec.Name.Name] = append(members[spec.Name.Name], field.Type.(*ast.Ident).Name)
+					}
+					for _, name := range field.Names {
+						members[spec.Name.Name] = append(members[spec.Name.Name], name.Name)
+					}
+				}
+			}
+		}
+	}
+	return members
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func topLevelNames(t *testing.T, src []byte) []string {
+	t.Helper()
+	f, err := goparser.ParseFile(gotoken.NewFileSet(), "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				names = append(names, decl.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, spec.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						if name.Name != "_" {
+							names = append(names, name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// declarations returns printed signatures of functions and methods and
+// types of struct fields and other types by their names, e.g. "F", "T.M",
+// "T.Field" and "T", struct types themselves are mapped to "struct".
+func declarations(t *testing.T, src []byte) map[string]string {
+	t.Helper()
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	print := func(node interface{}) string {
+		var b bytes.Buffer
+		if err := goprinter.Fprint(&b, fset, node); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	decls := map[string]string{}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name := decl.Name.Name
+			if decl.Recv != nil {
+				typ := decl.Recv.List[0].Type
+				if star, ok := typ.(*ast.StarExpr); ok {
+					typ = star.X
+				}
+				name = typ.(*ast.Ident).Name + "." + name
+			}
+			decls[name] = print(decl.Type)
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				spec, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				st, ok := spec.Type.(*ast.StructType)
+				if !ok {
+					decls[spec.Name.Name] = print(spec.Type)
+					continue
+				}
+				decls[spec.Name.Name] = "struct"
+				for _, field := range st.Fields.List {
+					for _, name := range field.Names {
+						decls[spec.Name.Name+"."+name.Name] = print(field.Type)
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// checkDeclarations checks that src declares all names with the given signatures.
+func checkDeclarations(t *testing.T, src []byte, want map[string]string) {
+	t.Helper()
+	decls := declarations(t, src)
+	for name, sig := range want {
+		if have, ok := decls[name]; !ok {
+			t.Errorf("%s is not declared", name)
+		} else if have != sig {
+			t.Errorf("%s = %s, want %s", name, have, sig)
+		}
+	}
+}
+
+func TestResolveNames(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Foo.Bar">
+		<method name="list">
+			<arg name="ctx" type="s" direction="in"/>
+			<arg name="path" type="s" direction="in"/>
+			<arg name="err" type="s" direction="out"/>
+			<arg name="path" type="u" direction="out"/>
+		</method>
+		<method name="List"/>
+		<signal name="Changed">
+			<arg name="value" type="u"/>
+			<arg name="Value" type="s"/>
+		</signal>
+		<property name="path" type="o" access="readwrite"/>
+	</interface>
+	<interface name="org.example.Foo">
+		<signal name="BarChanged"/>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = Print(&buf, ifaces, WithCamelize(true), WithFakes(true)); err != nil {
+		t.Fatal(err)
+	}
+	checkDeclarations(t, buf.Bytes(), map[string]string{
+		"OrgExampleFooBar.List":                    "func(ctx context.Context, inCtx string, path string) (outErr string, outPath uint32, err error)",
+		"OrgExampleFooBar.List2":                   "func(ctx context.Context) (err error)",
+		"OrgExampleFooBarChangedSignalBody.Value":  "uint32",
+		"OrgExampleFooBarChangedSignalBody.VValue": "string",
+		"OrgExampleFooBarChangedSignal":            "struct",
+		"OrgExampleFooBarChanged2Signal":           "struct",
+		"EmitOrgExampleFooBarPathChanged":          "func(conn *dbus.Conn, path dbus.ObjectPath, vPath dbus.ObjectPath) error",
+		"FakeOrgExampleFoo.WatchBarChanged2":       "func(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *OrgExampleFooBarChanged2Signal, error)",
+	})
+}
+
+func TestManagedObjectNames(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Path">
+		<property name="Value" type="s" access="read"/>
+	</interface>
+	<interface name="org.example.Interfaces"/>
+	<interface name="org.example.Implements"/>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := newContext(ifaces, WithPrefixes([]string{"org.example"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ManagedObject has fields named after interface types
+	for i, want := range []string{"Path2", "Interfaces2", "Implements2"} {
+		if have := ctx.tplIfaceType(ifaces[i]); have != want {
+			t.Errorf("ifaceType(%q) = %q, want %q", ifaces[i].Name, have, want)
+		}
+	}
+}
+
+func TestFakeNames(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Foo">
+		<method name="GetFooFunc"/>
+		<method name="WatchChanged"/>
+		<method name="EmitChanged"/>
+		<method name="Calls"/>
+		<method name="record"/>
+		<property name="Foo" type="s" access="readwrite"/>
+		<signal name="Changed"/>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := newContext(ifaces, WithFakes(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface := ifaces[0]
+	signal := iface.Signals[0]
+	for _, c := range []struct{ what, have, want string }{
+		{"GetFoo func", ctx.tplFakeFunc(iface, "GetFoo"), "GetFooFunc2"},
+		{"GetFooFunc func", ctx.tplFakeFunc(iface, "GetFooFunc"), "GetFooFuncFunc"},
+		{"Record func", ctx.tplFakeFunc(iface, "Record"), "RecordFunc"},
+		{"watch", ctx.tplClientWatchType(signal), "WatchChanged2"},
+		{"emit", ctx.tplFakeEmitType(signal), "EmitChanged2"},
+		{"calls", ctx.tplFakeCallsType(iface), "Calls2"},
+	} {
+		if c.have != c.want {
+			t.Errorf("%s = %q, want %q", c.what, c.have, c.want)
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	for name, want := range map[string]string{
+		"foo":         "foo",
+		"foo_bar":     "foo_bar",
+		"foo-bar":     "fooBar",
+		"foo bar-":    "fooBar",
+		"-foo":        "foo",
+		"naïve":       "naU00EFve",
+		"foo-über":    "fooU00FCber",
+		"日本":          "U65E5U672C",
+		"𝐀":           "U0001D400",
+		"€":           "",
+		"2nd":         "2nd",
+		"a.b/c":       "aBC",
+		"ObjectPath0": "ObjectPath0",
+	} {
+		if have := identifier(name); have != want {
+			t.Errorf("identifier(%q) = %q, want %q", name, have, want)
+		}
+	}
+}
+
+func TestMemberName(t *testing.T) {
+	for name, want := range map[string]string{
+		"Get":      "Get",
+		"get-all":  "GetAll",
+		"_private": "X_private",
+		"2nd":      "X2nd",
+		"über":     "U00FCber",
+		"ß":        "U00DF",
+		"":         "X",
+	} {
+		if have := (&context{}).memberName(name); have != want {
+			t.Errorf("memberName(%q) = %q, want %q", name, have, want)
+		}
+	}
+}
+
+func TestResolveNamesError(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		xml   string
+		opts  []PrintOption
+		error string
+	}{
+		"interface": {
+			xml: `<node>
+	<interface name="org.example.Foo"/>
+	<interface name="org.example.Bar"/>
+</node>`,
+			opts: []PrintOption{WithNames(map[string]string{
+				"org.example.Foo": "Foo",
+				"org.example.Bar": "Foo",
+			})},
+			error: "org.example.Bar interface conflicts with org.example.Foo interface",
+		},
+		"method": {
+			xml: `<node>
+	<interface name="org.example.Foo">
+		<method name="Get">
+			<annotation name="org.golang.Name" value="Lookup"/>
+		</method>
+		<method name="Find"/>
+	</interface>
+</node>`,
+			opts:  []PrintOption{WithNames(map[string]string{"org.example.Foo.Find": "Lookup"})},
+			error: "org.example.Foo.Find method conflicts with org.example.Foo.Get method",
+		},
+		"argument": {
+			xml: `<node>
+	<interface name="org.example.Foo">
+		<method name="Get">
+			<arg name="key" type="s" direction="in"/>
+			<annotation name="org.golang.Name.In0" value="ctx"/>
+		</method>
+	</interface>
+</node>`,
+			error: "org.example.Foo.Get.key argument conflicts with generated code",
+		},
+		"invalid": {
+			xml: `<node>
+	<interface name="org.example.Foo">
+		<signal name="Changed"/>
+	</interface>
+</node>`,
+			opts:  []PrintOption{WithNames(map[string]string{"org.example.Foo.Changed": "on-changed"})},
+			error: `org.example.Foo.Changed: name "on-changed" is not a valid identifier`,
+		},
+		"managed object": {
+			xml: `<node>
+	<interface name="org.example.Foo"/>
+</node>`,
+			opts:  []PrintOption{WithNames(map[string]string{"org.example.Foo": "Interfaces"})},
+			error: "org.example.Foo interface conflicts with generated code",
+		},
+		"struct": {
+			xml: `<node>
+	<interface name="org.example.Foo">
+		<property name="Entry" type="(ii)" access="read">
+			<annotation name="org.golang.StructName" value="Org_Example_Foo_Snapshot"/>
+		</property>
+	</interface>
+</node>`,
+			error: `org.example.Foo.Entry property struct "(ii)" conflicts with org.example.Foo interface`,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ifaces, err := parser.Parse([]byte(test.xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err = Print(&buf, ifaces, test.opts...); err == nil || err.Error() != test.error {
+				t.Errorf("Print error = %v, want %q", err, test.error)
+			}
+		})
+	}
+}
+
+func TestNameOverrides(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Foo.Device">
+		<annotation name="org.golang.Name" value="Device"/>
+		<method name="Get">
+			<arg name="key" type="s" direction="in"/>
+			<arg type="s" direction="out"/>
+			<annotation name="org.golang.Name" value="Lookup"/>
+			<annotation name="org.golang.Name.Out0" value="value"/>
+		</method>
+		<method name="Lookup"/>
+		<signal name="StateChanged">
+			<arg name="new_state" type="u"/>
+		</signal>
+		<property name="HwAddress" type="s" access="read"/>
+	</interface>
+	<interface name="org.example.Foo">
+		<method name="Ping"/>
+	</interface>
+	<interface name="org.example.Device"/>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = Print(&buf, ifaces, WithPrefixes([]string{"org.example", "org.example.Foo."}), WithNames(map[string]string{
+		"org.example.Foo.Device.Get.key":                "name",
+		"org.example.Foo.Device.StateChanged":           "State",
+		"org.example.Foo.Device.StateChanged.new_state": "Current",
+		"org.example.Foo.Device.HwAddress":              "MAC",
+		"org.example.Foo.Ping":                          "Alive",
+		"org.example.Unknown":                           "Ignored",
+	})); err != nil {
+		t.Fatal(err)
+	}
+	checkDeclarations(t, buf.Bytes(), map[string]string{
+		"Device.Lookup":                  "func(ctx context.Context, name string) (value string, err error)",
+		"Device.Lookup2":                 "func(ctx context.Context) (err error)",
+		"Device_StateSignal":             "struct",
+		"Device_StateSignalBody.Current": "uint32",
+		"Device.GetMAC":                  "func(ctx context.Context) (hwAddress string, err error)",
+		"Foo.Alive":                      "func(ctx context.Context) (err error)",
+		// the generated name conflicting with an explicit one gets a suffix
+		"Device2": "struct",
+	})
+}
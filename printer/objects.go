@@ -0,0 +1,253 @@
+package printer
+
+// objectsTpl is a client-side runtime for consuming
+// org.freedesktop.DBus.ObjectManager objects.
+const objectsTpl = `{{define "objects"}}{{import "context"}}{{import "errors"}}{{import "sort"}}{{import "sync"}}{{import "github.com/godbus/dbus/v5"}}
+// ManagedObject is an object exported by an org.freedesktop.DBus.ObjectManager
+// with typed proxies and properties snapshots of implemented interfaces,
+// fields of interfaces not implemented by the object are nil.
+type ManagedObject struct {
+	Path dbus.ObjectPath
+
+	// Interfaces lists names of all implemented interfaces
+	// including ones that don't have generated code.
+	Interfaces []string
+{{range $iface := .Interfaces}}
+	{{ifaceType $iface}} *{{ifaceType $iface}}
+	{{- if haveReadableProperties $iface}}
+	{{propertiesType $iface}} *{{propertiesType $iface}}
+	{{- end}}
+{{- end}}
+}
+
+// Implements reports whether the object implements the named interface.
+func (o *ManagedObject) Implements(iface string) bool {
+	i := sort.SearchStrings(o.Interfaces, iface)
+	return i < len(o.Interfaces) && o.Interfaces[i] == iface
+}
+
+// withInterfaces returns a copy of the object with the given interfaces added.
+func (o *ManagedObject) withInterfaces(obj dbus.BusObject, ifaces map[string]map[string]dbus.Variant) (*ManagedObject, error) {
+	c := *o
+	c.Interfaces = make([]string, len(o.Interfaces), len(o.Interfaces)+len(ifaces))
+	copy(c.Interfaces, o.Interfaces)
+	for iface, {{if anyReadableProperties .Interfaces}}props{{else}}_{{end}} := range ifaces {
+		if !o.Implements(iface) {
+			c.Interfaces = append(c.Interfaces, iface)
+		}
+		switch iface {
+		{{- range $iface := .Interfaces}}
+		case {{ifaceNameConst $iface}}:
+			c.{{ifaceType $iface}} = New{{ifaceType $iface}}(obj)
+			{{- if haveReadableProperties $iface}}
+			c.{{propertiesType $iface}} = &{{propertiesType $iface}}{}
+			if err := c.{{propertiesType $iface}}.decode(props); err != nil {
+				return nil, err
+			}
+			{{- end}}
+		{{- end}}
+		}
+	}
+	sort.Strings(c.Interfaces)
+	return &c, nil
+}
+
+// withoutInterfaces returns a copy of the object with the given interfaces removed.
+func (o *ManagedObject) withoutInterfaces(ifaces []string) *ManagedObject {
+	c := *o
+	c.Interfaces = make([]string, 0, len(o.Interfaces))
+	for _, iface := range o.Interfaces {
+		var found bool
+		for i := range ifaces {
+			if ifaces[i] == iface {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.Interfaces = append(c.Interfaces, iface)
+		}
+	}
+	for _, iface := range ifaces {
+		switch iface {
+		{{- range $iface := .Interfaces}}
+		case {{ifaceNameConst $iface}}:
+			c.{{ifaceType $iface}} = nil
+			{{- if haveReadableProperties $iface}}
+			c.{{propertiesType $iface}} = nil
+			{{- end}}
+		{{- end}}
+		}
+	}
+	return &c
+}
+
+// GetManagedObjects returns all objects exported by
+// the named org.freedesktop.DBus.ObjectManager object.
+func GetManagedObjects(ctx context.Context, conn *dbus.Conn, dest string, path dbus.ObjectPath) (map[dbus.ObjectPath]*ManagedObject, error) {
+	call := conn.Object(dest, path).CallWithContext(
+		ctx, "org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0,
+	)
+	if call.Err != nil {
+		return nil, call.Err
+	}
+	// type assertion instead of storing keeps variants signatures intact
+	var raw map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	if len(call.Body) != 0 {
+		raw, _ = call.Body[0].(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	}
+	if raw == nil {
+		return nil, errors.New("GetManagedObjects reply has unexpected signature")
+	}
+	objects := make(map[dbus.ObjectPath]*ManagedObject, len(raw))
+	for path, ifaces := range raw {
+		o, err := (&ManagedObject{Path: path}).withInterfaces(conn.Object(dest, path), ifaces)
+		if err != nil {
+			return nil, err
+		}
+		objects[path] = o
+	}
+	return objects, nil
+}
+
+// ObjectCache is a live cache of objects exported by an
+// org.freedesktop.DBus.ObjectManager object kept up to date by
+// tracking its InterfacesAdded and InterfacesRemoved signals.
+//
+// Cached objects are never modified, changes replace them with new ones.
+type ObjectCache struct {
+	conn    *dbus.Conn
+	dest    string
+	added   *watcher
+	removed *watcher
+	sigc    chan *dbus.Signal
+	stop    chan struct{}
+	once    sync.Once
+
+	mu      sync.RWMutex
+	objects map[dbus.ObjectPath]*ManagedObject
+}
+
+// NewObjectCache loads objects exported by the named object manager
+// and starts tracking their changes, the cache has to be closed with
+// Close when it's not needed anymore.
+func NewObjectCache(ctx context.Context, conn *dbus.Conn, dest string, path dbus.ObjectPath) (*ObjectCache, error) {
+	c := &ObjectCache{
+		conn: conn,
+		dest: dest,
+		added: newWatcher("org.freedesktop.DBus.ObjectManager", "InterfacesAdded", []WatchOption{
+			WithWatchSender(dest), WithWatchPath(path),
+		}),
+		removed: newWatcher("org.freedesktop.DBus.ObjectManager", "InterfacesRemoved", []WatchOption{
+			WithWatchSender(dest), WithWatchPath(path),
+		}),
+		sigc: make(chan *dbus.Signal, 16),
+		stop: make(chan struct{}),
+	}
+	if err := c.added.addMatch(ctx, conn); err != nil {
+		return nil, err
+	}
+	if err := c.removed.addMatch(ctx, conn); err != nil {
+		c.added.removeMatch(conn)
+		return nil, err
+	}
+
+	// subscribe before loading objects to not miss changes
+	conn.Signal(c.sigc)
+	objects, err := GetManagedObjects(ctx, conn, dest, path)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.objects = objects
+	go c.track()
+	return c, nil
+}
+
+// track applies changes to cached objects, signals that
+// cannot be decoded are skipped.
+func (c *ObjectCache) track() {
+	for {
+		select {
+		case sig, ok := <-c.sigc:
+			if !ok {
+				return
+			}
+			var path dbus.ObjectPath
+			switch {
+			case c.added.matches(sig):
+				if len(sig.Body) != 2 {
+					continue
+				}
+				path, _ = sig.Body[0].(dbus.ObjectPath)
+				ifaces, ok := sig.Body[1].(map[string]map[string]dbus.Variant)
+				if !ok {
+					continue
+				}
+				c.mu.RLock()
+				o, ok := c.objects[path]
+				c.mu.RUnlock()
+				if !ok {
+					o = &ManagedObject{Path: path}
+				}
+				o, err := o.withInterfaces(c.conn.Object(c.dest, path), ifaces)
+				if err != nil {
+					continue
+				}
+				c.mu.Lock()
+				c.objects[path] = o
+				c.mu.Unlock()
+			case c.removed.matches(sig):
+				var ifaces []string
+				if err := dbus.Store(sig.Body, &path, &ifaces); err != nil {
+					continue
+				}
+				c.mu.Lock()
+				if o, ok := c.objects[path]; ok {
+					if o = o.withoutInterfaces(ifaces); len(o.Interfaces) == 0 {
+						delete(c.objects, path)
+					} else {
+						c.objects[path] = o
+					}
+				}
+				c.mu.Unlock()
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Object returns the cached object with the given path.
+func (c *ObjectCache) Object(path dbus.ObjectPath) (*ManagedObject, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	o, ok := c.objects[path]
+	return o, ok
+}
+
+// Objects returns all cached objects sorted by path.
+func (c *ObjectCache) Objects() []*ManagedObject {
+	c.mu.RLock()
+	objects := make([]*ManagedObject, 0, len(c.objects))
+	for _, o := range c.objects {
+		objects = append(objects, o)
+	}
+	c.mu.RUnlock()
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Path < objects[j].Path
+	})
+	return objects
+}
+
+// Close stops tracking changes of the cached objects.
+func (c *ObjectCache) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+		c.conn.RemoveSignal(c.sigc)
+		c.added.removeMatch(c.conn)
+		c.removed.removeMatch(c.conn)
+	})
+	return nil
+}
+{{end}}`
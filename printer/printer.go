@@ -7,7 +7,7 @@ import (
 	gotoken "go/token"
 	"io"
 	"regexp"
-	"text/template"
+	"strings"
 
 	"github.com/amenzhinsky/dbus-codegen-go/token"
 )
@@ -32,8 +32,9 @@ func WithGofmt(enable bool) PrintOption {
 	}
 }
 
-// WithPrefixes prefixes to strip from interface names, be careful
-// when using it may lead to compilation errors.
+// WithPrefixes sets prefixes to strip from interface names,
+// the longest one followed by a dot is stripped, e.g. org.freedesktop
+// makes org.freedesktop.UDisks2.Block just UDisks2_Block.
 func WithPrefixes(prefixes []string) PrintOption {
 	return func(ctx *context) {
 		ctx.prefixes = prefixes
@@ -54,24 +55,102 @@ func WithClientOnly(enable bool) PrintOption {
 	}
 }
 
+// WithStructFields sets field names of generated structs by their
+// signatures, e.g. "(so)" => ["Name", "Path"], field names provided
+// by annotations take precedence.
+func WithStructFields(fields map[string][]string) PrintOption {
+	return func(ctx *context) {
+		ctx.fieldNames = fields
+	}
+}
+
+// WithNames overrides generated names, names is a map of D-Bus names to
+// Go names, keys are interface names, interface names joined with member
+// names or interface, member and argument names joined with dots, e.g.
+// org.freedesktop.NetworkManager.Device.Disconnect. Interface names take
+// precedence, keys matching nothing are ignored.
+func WithNames(names map[string]string) PrintOption {
+	return func(ctx *context) {
+		ctx.names = names
+	}
+}
+
+// TypeMapping substitutes a Go type for D-Bus values of arguments
+// and properties, Decode is a func(v T) (Type, error) where T is the
+// type generated for the signature and Encode is a func(v Type) T.
+//
+// Qualified names are prefixed with import paths,
+// e.g. time.Time or github.com/google/uuid.Parse.
+type TypeMapping struct {
+	Type   string
+	Decode string
+	Encode string
+}
+
+// WithTypes sets Go types of arguments and properties, types is a map of
+// either D-Bus signatures, e.g. "ay", or keys the same as of WithNames
+// to mappings, signatures match whole types only. Keys naming arguments
+// and properties take precedence over annotations and signatures.
+func WithTypes(types map[string]*TypeMapping) PrintOption {
+	return func(ctx *context) {
+		ctx.types = types
+	}
+}
+
 func WithCamelize(enable bool) PrintOption {
 	return func(ctx *context) {
 		ctx.camelize = enable
 	}
 }
 
+// WithIdiomatic makes names follow Go conventions, they're camelized
+// and initialisms are spelled consistently, e.g. GetUUID instead of GetUuid.
+func WithIdiomatic(enable bool) PrintOption {
+	return func(ctx *context) {
+		ctx.idiomatic = enable
+	}
+}
+
+// WithInitialisms adds initialisms recognized in idiomatic names,
+// they also override spelling of default ones, e.g. "Dbus" instead of "DBus".
+func WithInitialisms(initialisms []string) PrintOption {
+	return func(ctx *context) {
+		ctx.extraInitialisms = initialisms
+	}
+}
+
+// WithServerContext makes server methods and property accessors
+// receive a context carrying CallInfo of the call being handled.
+func WithServerContext(enable bool) PrintOption {
+	return func(ctx *context) {
+		ctx.ServerContext = enable
+	}
+}
+
+// WithFakes makes the printer generate an interface for each client
+// along with its in-memory fake implementation for unit tests.
+func WithFakes(enable bool) PrintOption {
+	return func(ctx *context) {
+		ctx.Fakes = enable
+	}
+}
+
 var identRegexp = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9_]*$")
 
-const clientTpl = `// Code generated by dbus-codegen-go DO NOT EDIT.
+// headerTpl is executed after the file's body to collect its imports.
+const headerTpl = `// Code generated by dbus-codegen-go DO NOT EDIT.
 package {{.PackageName}}
-
+{{if ne (len .Imports) 0}}
 import (
 {{- range $import := .Imports}}
 	"{{$import}}"
 {{- end}}
 )
+{{end}}`
 
-{{if haveSignals .Interfaces}}
+// commonTpl contains code shared by all interfaces.
+const commonTpl = `{{define "common"}}
+{{- if haveSignals .Interfaces}}{{import "github.com/godbus/dbus/v5"}}
 // Signal is a common interface for all signals.
 type Signal interface {
 	Name()      string
@@ -89,7 +168,7 @@ func Emit(conn *dbus.Conn, s Signal) error {
 }
 {{end -}}
 
-{{if not $.ServerOnly}}
+{{if not $.ServerOnly}}{{import "errors"}}{{import "fmt"}}
 // ErrUnknownSignal is returned by LookupSignal when a signal cannot be resolved.
 var ErrUnknownSignal = errors.New("unknown signal")
 
@@ -104,17 +183,23 @@ func LookupSignal(signal *dbus.Signal) (Signal, error) {
 			return nil, fmt.Errorf("signal has %v args rather than the expected {{len $signal.Args}}", len(signal.Body))
 		}
 {{- range $i, $argument := $signal.Args}}
-		v{{$i}}, ok := signal.Body[{{$i}}].({{$argument.Type}})
-		if !ok {
-			return nil, fmt.Errorf("prop .{{argName $argument "v" $i true}} is %T, not {{$argument.Type}}", signal.Body[{{$i}}])
+		var v{{$i}} {{argRawType $argument}}
+		if err := dbus.Store(signal.Body[{{$i}}:{{$i}}+1], &v{{$i}}); err != nil {
+			return nil, fmt.Errorf("prop .{{argName $argument "v" $i true}} is %T, not {{argRawType $argument}}", signal.Body[{{$i}}])
 		}
+{{- if argMapped $argument}}
+		d{{$i}}, err := {{decodeArg $argument}}(v{{$i}})
+		if err != nil {
+			return nil, fmt.Errorf("prop .{{argName $argument "v" $i true}}: %w", err)
+		}
+{{- end}}
 {{- end}}
 		return &{{signalType $iface $signal}}{
 			sender: signal.Sender,
 			Path:   signal.Path,
 			Body: &{{signalBodyType $iface $signal}}{
 {{- range $i, $argument := $signal.Args}}
-				{{argName $argument "v" $i true}}: v{{$i}},
+				{{argName $argument "v" $i true}}: {{if argMapped $argument}}d{{else}}v{{end}}{{$i}},
 {{- end}}
 			},
 		}, nil
@@ -144,12 +229,35 @@ func RemoveMatchSignal(conn *dbus.Conn, s Signal, opts ...dbus.MatchOption) erro
 {{end -}}
 {{end -}}
 
+{{- if not $.ServerOnly}}
+{{- if or (haveSignals .Interfaces) (anyReadableProperties .Interfaces)}}
+{{- template "client" .}}
+{{- end}}
+{{- if haveSignals .Interfaces}}
+{{- template "dispatcher" .}}
+{{- end}}
+{{- end}}
+
+{{- if and (not $.ServerOnly) (haveObjectManager .Interfaces)}}
+{{- template "objects" .}}
+{{- end}}
+
+{{- if and (not $.ServerOnly) $.Fakes}}
+{{- template "fakes" .}}
+{{- end}}
+
+{{- if not $.ClientOnly}}
+{{- template "server" .}}
+{{- end}}
+
 // Interface name constants.
 const (
 {{- range $iface := .Interfaces}}
 	{{ifaceNameConst $iface}} = "{{$iface.Name}}"
 {{- end}}
 )
+{{end}}
+{{- define "serverCtx"}}{{if .ServerContext}}{{import "context"}}ctx context.Context, {{end}}{{end}}
 {{- define "annotations"}}
 {{- if ne (len .Annotations) 0 }}
 //
@@ -159,30 +267,189 @@ const (
 {{- end}}
 {{- end}}
 {{- end}}
-{{range $iface := .Interfaces}}
+`
+
+// ifaceTpl contains code of a single interface.
+const ifaceTpl = `{{define "iface"}}{{$iface := .Interface}}{{$ := .Context}}{{import "github.com/godbus/dbus/v5"}}
+{{- range $struct := ifaceStructs $iface}}
+// {{$struct.Name}} is a struct with {{$struct.Type.Signature}} D-Bus signature.
+type {{$struct.Name}} struct {
+	{{structFields $struct}}
+}
+{{end}}
 {{if not $.ClientOnly -}}
 // {{serverType $iface}} is {{$iface.Name}} interface.
 type {{serverType $iface}} interface {
 	{{range $method := $iface.Methods -}}
 	// {{methodType $method}} is {{$iface.Name}}.{{$method.Name}} method.
-	{{methodType $method}}({{joinMethodInArgs $method}}) ({{joinMethodOutArgs $method}}err *dbus.Error)
+	{{methodType $method}}({{template "serverCtx" $}}{{joinMethodInArgs $method}}) ({{joinMethodOutArgs $method}}err *dbus.Error)
+	{{end -}}
+	{{range $prop := $iface.Properties -}}
+	{{if propNeedsGet $iface $prop -}}
+	// {{propGetType $prop}} gets {{$iface.Name}}.{{$prop.Name}} property.
+	{{propGetType $prop}}({{template "serverCtx" $}}) ({{propArgName $prop}} {{argType $prop.Arg}}, err *dbus.Error)
+	{{end -}}
+	{{if propNeedsSet $iface $prop -}}
+	// {{propSetType $prop}} sets {{$iface.Name}}.{{$prop.Name}} property.
+	{{propSetType $prop}}({{template "serverCtx" $}}{{propArgName $prop}} {{argType $prop.Arg}}) (err *dbus.Error)
+	{{end -}}
 	{{end}}
 }
 
+// {{ifaceXMLConst $iface}} is introspection data of {{$iface.Name}} interface.
+const {{ifaceXMLConst $iface}} = {{ifaceXML $iface}}
+
 // Export{{ifaceType $iface}} exports the given object that implements {{$iface.Name}} on the bus.
+//
+// The path is made introspectable with org.freedesktop.DBus.Introspectable
+// interface describing all interfaces exported on it with Export functions.
+{{- if ne (len $iface.Properties) 0}}
+// Its properties are served by org.freedesktop.DBus.Properties interface
+// exported on the same path along with properties of other interfaces.
+{{- end}}
+//
+// The object is kept referenced until it's unexported with
+// Unexport{{ifaceType $iface}} or the connection is closed.
 func Export{{ifaceType $iface}}(conn *dbus.Conn, path dbus.ObjectPath, v {{serverType $iface}}) error {
-	return conn.ExportSubtreeMethodTable(map[string]interface{}{
+	if err := conn.ExportSubtreeMethodTable(map[string]interface{}{
 		{{range $method := $iface.Methods -}}
+		{{if methodMapped $method -}}
+		"{{$method.Name}}": func({{template "callMsg" $}}{{joinRawArgs $method.In "in"}}) ({{joinRawArgs $method.Out "out"}}err *dbus.Error) {
+			{{- range $i, $arg := $method.In}}
+			{{- if argMapped $arg}}
+			{{argName $arg "in" $i false}}, convErr := {{decodeArg $arg}}({{argRawName $arg}})
+			if convErr != nil {
+				err = invalidArgs(convErr)
+				return
+			}
+			{{- end}}
+			{{- end}}
+			{{- range $i, $arg := $method.Out}}
+			{{- if argMapped $arg}}
+			var {{argName $arg "out" $i false}} {{argType $arg}}
+			{{- end}}
+			{{- end}}
+			if {{range $i, $arg := $method.Out}}{{argName $arg "out" $i false}}, {{end}}err = v.{{methodType $method}}({{if $.ServerContext}}newCallContext(msg), {{end}}{{joinArgNames $method.In}}); err != nil {
+				return
+			}
+			{{- range $i, $arg := $method.Out}}
+			{{- if argMapped $arg}}
+			{{argRawName $arg}} = {{encodeArg $arg (argName $arg "out" $i false)}}
+			{{- end}}
+			{{- end}}
+			return
+		},
+		{{else if $.ServerContext -}}
+		"{{$method.Name}}": func(msg dbus.Message, {{joinMethodInArgs $method}}) ({{joinMethodOutArgs $method}}err *dbus.Error) {
+			return v.{{methodType $method}}(newCallContext(msg), {{joinArgNames $method.In}})
+		},
+		{{else -}}
 		"{{$method.Name}}": v.{{methodType $method}},
-		{{end -}} 
-	}, path, {{ifaceNameConst $iface}})
+		{{end -}}
+		{{end -}}
+	}, path, {{ifaceNameConst $iface}}); err != nil {
+		return err
+	}
+	return exportIface(conn, path, {{ifaceNameConst $iface}}, &exportedIface{
+		xml: {{ifaceXMLConst $iface}},
+		{{- if ne (len $iface.Properties) 0}}{{import "context"}}
+		props: map[string]*exportedProperty{
+			{{range $prop := $iface.Properties -}}
+			"{{$prop.Name}}": {
+				{{- if propNeedsGet $iface $prop}}
+				get: func(ctx context.Context) (interface{}, *dbus.Error) {
+					{{- if argMapped $prop.Arg}}
+					val, err := v.{{propGetType $prop}}({{if $.ServerContext}}ctx{{end}})
+					if err != nil {
+						return nil, err
+					}
+					return {{encodeArg $prop.Arg "val"}}, nil
+					{{- else}}
+					return v.{{propGetType $prop}}({{if $.ServerContext}}ctx{{end}})
+					{{- end}}
+				},
+				{{- end}}
+				{{- if propNeedsSet $iface $prop}}
+				set: func(ctx context.Context, value dbus.Variant) *dbus.Error {
+					{{- if argMapped $prop.Arg}}
+					var raw {{argRawType $prop.Arg}}
+					if err := storeProperty(value, "{{$prop.Arg.Type.Signature}}", &raw); err != nil {
+						return err
+					}
+					val, convErr := {{decodeArg $prop.Arg}}(raw)
+					if convErr != nil {
+						return invalidArgs(convErr)
+					}
+					{{- else}}
+					var val {{argType $prop.Arg}}
+					if err := storeProperty(value, "{{$prop.Arg.Type.Signature}}", &val); err != nil {
+						return err
+					}
+					{{- end}}
+					{{- if eq (propEmitsChanged $iface $prop) "true" "invalidates"}}
+					if err := v.{{propSetType $prop}}({{if $.ServerContext}}ctx, {{end}}val); err != nil {
+						return err
+					}
+					{{- if and (eq (propEmitsChanged $iface $prop) "true") (propNeedsGet $iface $prop)}}
+					// the setter may normalize the value so the stored one is announced,
+					// when it cannot be read back the property is invalidated instead
+					var emitErr error
+					if stored, err := v.{{propGetType $prop}}({{if $.ServerContext}}ctx{{end}}); err != nil {
+						emitErr = emitPropertiesChanged(conn, path, {{ifaceNameConst $iface}}, nil, []string{"{{$prop.Name}}"})
+					} else {
+						emitErr = {{propEmitType $iface $prop}}(conn, path, stored)
+					}
+					if emitErr != nil {
+						return dbus.MakeFailedError(emitErr)
+					}
+					return nil
+					{{- else}}
+					{{- if eq (propEmitsChanged $iface $prop) "true"}}
+					if err := {{propEmitType $iface $prop}}(conn, path, val); err != nil {
+					{{- else}}
+					if err := {{propEmitType $iface $prop}}(conn, path); err != nil {
+					{{- end}}
+						return dbus.MakeFailedError(err)
+					}
+					return nil
+					{{- end}}
+					{{- else}}
+					return v.{{propSetType $prop}}({{if $.ServerContext}}ctx, {{end}}val)
+					{{- end}}
+				},
+				{{- end}}
+			},
+			{{end -}}
+		},
+		{{- end}}
+	})
 }
 
 // Unexport{{ifaceType $iface}} unexports {{$iface.Name}} interface on the named path.
 func Unexport{{ifaceType $iface}}(conn *dbus.Conn, path dbus.ObjectPath) error {
+	if err := unexportIface(conn, path, {{ifaceNameConst $iface}}); err != nil {
+		return err
+	}
 	return conn.Export(nil, path, {{ifaceNameConst $iface}})
 }
 
+{{- range $prop := $iface.Properties}}
+{{- if eq (propEmitsChanged $iface $prop) "true"}}
+// {{propEmitType $iface $prop}} emits org.freedesktop.DBus.Properties.PropertiesChanged
+// signal notifying that {{$iface.Name}}.{{$prop.Name}} property has been changed to the given value.
+func {{propEmitType $iface $prop}}(conn *dbus.Conn, path dbus.ObjectPath, {{propArgName $prop}} {{argType $prop.Arg}}) error {
+	return emitPropertiesChanged(conn, path, {{ifaceNameConst $iface}}, map[string]dbus.Variant{
+		"{{$prop.Name}}": dbus.MakeVariant({{encodeArg $prop.Arg (propArgName $prop)}}),
+	}, nil)
+}
+{{else if eq (propEmitsChanged $iface $prop) "invalidates"}}
+// {{propEmitType $iface $prop}} emits org.freedesktop.DBus.Properties.PropertiesChanged
+// signal notifying that {{$iface.Name}}.{{$prop.Name}} property has been invalidated.
+func {{propEmitType $iface $prop}}(conn *dbus.Conn, path dbus.ObjectPath) error {
+	return emitPropertiesChanged(conn, path, {{ifaceNameConst $iface}}, nil, []string{"{{$prop.Name}}"})
+}
+{{end}}
+{{- end}}
 // {{unimplementedType $iface}} can be embedded to have forward compatible server implementations.
 type {{unimplementedType $iface}} struct{}
 
@@ -191,15 +458,32 @@ func (*{{unimplementedType $iface}}) iface() string {
 }
 
 {{range $method := $iface.Methods -}}
-func (*{{unimplementedType $iface}}) {{methodType $method}}({{joinMethodInArgs $method}}) ({{joinMethodOutArgs $method}}err *dbus.Error) {
+func (*{{unimplementedType $iface}}) {{methodType $method}}({{template "serverCtx" $}}{{joinMethodInArgs $method}}) ({{joinMethodOutArgs $method}}err *dbus.Error) {
 	err = &dbus.ErrMsgUnknownMethod
 	return
 }
 
 {{end}}
+{{- range $prop := $iface.Properties -}}
+{{if propNeedsGet $iface $prop -}}
+func (*{{unimplementedType $iface}}) {{propGetType $prop}}({{template "serverCtx" $}}) ({{propArgName $prop}} {{argType $prop.Arg}}, err *dbus.Error) {
+	err = ErrUnknownProperty
+	return
+}
+
+{{end}}
+{{- if propNeedsSet $iface $prop -}}
+func (*{{unimplementedType $iface}}) {{propSetType $prop}}({{template "serverCtx" $}}{{propArgName $prop}} {{argType $prop.Arg}}) (err *dbus.Error) {
+	err = ErrUnknownProperty
+	return
+}
+
+{{end}}
+{{- end}}
 {{- end}}
 
 {{if not $.ServerOnly -}}
+{{if or (ne (len $iface.Methods) 0) (ne (len $iface.Properties) 0) (ne (len $iface.Signals) 0)}}{{import "context"}}{{end -}}
 // New{{ifaceType $iface}} creates and allocates {{$iface.Name}}.
 func New{{ifaceType $iface}}(object dbus.BusObject) *{{ifaceType $iface}} {
 	return &{{ifaceType $iface}}{object}
@@ -219,7 +503,25 @@ type {{ifaceType $iface}} struct {
 {{- end}}
 {{- template "annotations" $method}}
 func (o *{{ifaceType $iface}}) {{methodType $method}}(ctx context.Context, {{joinMethodInArgs $method}}) ({{joinMethodOutArgs $method}}err error) {
-	err = o.object.CallWithContext(ctx, {{ifaceNameConst $iface}} + ".{{$method.Name}}", {{methodFlags $method}}, {{joinArgNames $method.In}}).Store({{joinStoreArgs $method.Out}})
+	{{- if argsMapped $method.Out}}
+	{{- range $i, $arg := $method.Out}}
+	{{- if argMapped $arg}}
+	var {{argRawName $arg}} {{argRawType $arg}}
+	{{- end}}
+	{{- end}}
+	if err = o.object.CallWithContext(ctx, {{ifaceNameConst $iface}} + ".{{$method.Name}}", {{methodFlags $method}}, {{joinCallArgs $method.In}}).Store({{joinStoreArgs $method.Out}}); err != nil {
+		return
+	}
+	{{- range $i, $arg := $method.Out}}
+	{{- if argMapped $arg}}
+	if {{argName $arg "out" $i false}}, err = {{decodeArg $arg}}({{argRawName $arg}}); err != nil {
+		return
+	}
+	{{- end}}
+	{{- end}}
+	{{- else}}
+	err = o.object.CallWithContext(ctx, {{ifaceNameConst $iface}} + ".{{$method.Name}}", {{methodFlags $method}}, {{joinCallArgs $method.In}}).Store({{joinStoreArgs $method.Out}})
+	{{- end}}
 	return
 }
 {{end}}
@@ -227,19 +529,201 @@ func (o *{{ifaceType $iface}}) {{methodType $method}}(ctx context.Context, {{joi
 {{- if propNeedsGet $iface $prop}}
 // {{propGetType $prop}} gets {{$iface.Name}}.{{$prop.Name}} property.
 {{- template "annotations" $prop}}
-func (o *{{ifaceType $iface}}) {{propGetType $prop}}(ctx context.Context) ({{propArgName $prop}} {{$prop.Arg.Type}}, err error) {
+func (o *{{ifaceType $iface}}) {{propGetType $prop}}(ctx context.Context) ({{propArgName $prop}} {{argType $prop.Arg}}, err error) {
+	{{- if argMapped $prop.Arg}}
+	var {{argRawName $prop.Arg}} {{argRawType $prop.Arg}}
+	if err = o.object.CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0, {{ifaceNameConst $iface}}, "{{$prop.Name}}").Store(&{{argRawName $prop.Arg}}); err != nil {
+		return
+	}
+	return {{decodeArg $prop.Arg}}({{argRawName $prop.Arg}})
+	{{- else}}
 	err = o.object.CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0, {{ifaceNameConst $iface}}, "{{$prop.Name}}").Store(&{{propArgName $prop}})
 	return
+	{{- end}}
 }
 {{- end}}
 {{- if propNeedsSet $iface $prop}}
 // {{propSetType $prop}} sets {{$iface.Name}}.{{$prop.Name}} property.
 {{- template "annotations" $prop}}
-func (o *{{ifaceType $iface}}) {{propSetType $prop}}(ctx context.Context, {{propArgName $prop}} {{$prop.Arg.Type}}) error {
-	return o.object.CallWithContext(ctx, "org.freedesktop.DBus.Properties.Set", 0, {{ifaceNameConst $iface}}, "{{$prop.Name}}", dbus.MakeVariant({{propArgName $prop}})).Store()
+func (o *{{ifaceType $iface}}) {{propSetType $prop}}(ctx context.Context, {{propArgName $prop}} {{argType $prop.Arg}}) error {
+	return o.object.CallWithContext(ctx, "org.freedesktop.DBus.Properties.Set", 0, {{ifaceNameConst $iface}}, "{{$prop.Name}}", dbus.MakeVariant({{encodeArg $prop.Arg (propArgName $prop)}})).Store()
 }
 {{- end}}
 {{end}}
+{{- if haveReadableProperties $iface}}{{import "fmt"}}
+// {{propertiesType $iface}} is a snapshot of {{$iface.Name}} readable properties values.
+type {{propertiesType $iface}} struct {
+	{{range $prop := $iface.Properties -}}
+	{{if $prop.Read -}}
+	{{propType $prop}} {{argType $prop.Arg}}
+	{{end -}}
+	{{end}}
+}
+
+// decode stores the given property values into p, missing ones are left untouched.
+func (p *{{propertiesType $iface}}) decode(values map[string]dbus.Variant) error {
+	{{- range $prop := $iface.Properties}}
+	{{- if $prop.Read}}
+	if v, ok := values["{{$prop.Name}}"]; ok {
+		if sig := v.Signature().String(); sig != "{{$prop.Arg.Type.Signature}}" {
+			return fmt.Errorf("%s.{{$prop.Name}} property: signature is %s rather than {{$prop.Arg.Type.Signature}}", {{ifaceNameConst $iface}}, sig)
+		}
+		{{- if argMapped $prop.Arg}}
+		var raw {{argRawType $prop.Arg}}
+		if err := v.Store(&raw); err != nil {
+			return fmt.Errorf("%s.{{$prop.Name}} property: %w", {{ifaceNameConst $iface}}, err)
+		}
+		val, err := {{decodeArg $prop.Arg}}(raw)
+		if err != nil {
+			return fmt.Errorf("%s.{{$prop.Name}} property: %w", {{ifaceNameConst $iface}}, err)
+		}
+		p.{{propType $prop}} = val
+		{{- else}}
+		if err := v.Store(&p.{{propType $prop}}); err != nil {
+			return fmt.Errorf("%s.{{$prop.Name}} property: %w", {{ifaceNameConst $iface}}, err)
+		}
+		{{- end}}
+	}
+	{{- end}}
+	{{- end}}
+	return nil
+}
+{{- if getAllNeeded $iface}}
+
+// GetAllProperties gets values of all {{$iface.Name}} readable properties
+// with a single org.freedesktop.DBus.Properties.GetAll call.
+func (o *{{ifaceType $iface}}) GetAllProperties(ctx context.Context) (*{{propertiesType $iface}}, error) {
+	call := o.object.CallWithContext(ctx, "org.freedesktop.DBus.Properties.GetAll", 0, {{ifaceNameConst $iface}})
+	if call.Err != nil {
+		return nil, call.Err
+	}
+	// type assertion instead of storing keeps variants signatures intact
+	var values map[string]dbus.Variant
+	if len(call.Body) != 0 {
+		values, _ = call.Body[0].(map[string]dbus.Variant)
+	}
+	if values == nil {
+		return nil, fmt.Errorf("%s properties: GetAll reply has unexpected signature", {{ifaceNameConst $iface}})
+	}
+	p := &{{propertiesType $iface}}{}
+	if err := p.decode(values); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+{{- end}}
+
+// {{changesType $iface}} is a set of {{$iface.Name}} properties changes
+// announced with org.freedesktop.DBus.Properties.PropertiesChanged signal.
+type {{changesType $iface}} struct {
+	sender string
+	Path   dbus.ObjectPath
+
+	// Changed contains values of changed properties.
+	Changed {{changedType $iface}}
+
+	// Invalidated lists names of changed properties without values.
+	Invalidated []string
+}
+
+// {{changedType $iface}} contains values of changed {{$iface.Name}} properties,
+// nil fields haven't been changed or their values aren't included.
+type {{changedType $iface}} struct {
+	{{range $prop := $iface.Properties -}}
+	{{if $prop.Read -}}
+	{{propType $prop}} *{{argType $prop.Arg}}
+	{{end -}}
+	{{end}}
+}
+
+// Sender returns the signal's sender unique name.
+func (c *{{changesType $iface}}) Sender() string {
+	return c.sender
+}
+
+// Apply updates the snapshot with the changed values.
+func (c *{{changesType $iface}}) Apply(p *{{propertiesType $iface}}) {
+	{{- range $prop := $iface.Properties}}
+	{{- if $prop.Read}}
+	if c.Changed.{{propType $prop}} != nil {
+		p.{{propType $prop}} = *c.Changed.{{propType $prop}}
+	}
+	{{- end}}
+	{{- end}}
+}
+
+// {{changesParseType $iface}} decodes the given org.freedesktop.DBus.Properties.PropertiesChanged
+// signal announcing changes of {{$iface.Name}} properties.
+func {{changesParseType $iface}}(sig *dbus.Signal) (*{{changesType $iface}}, error) {
+	if sig.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" || len(sig.Body) != 3 {
+		return nil, fmt.Errorf("%s is not a PropertiesChanged signal", sig.Name)
+	}
+	if iface, _ := sig.Body[0].(string); iface != {{ifaceNameConst $iface}} {
+		return nil, fmt.Errorf("PropertiesChanged signal of %s rather than %s interface", iface, {{ifaceNameConst $iface}})
+	}
+	changed, ok := sig.Body[1].(map[string]dbus.Variant)
+	if !ok {
+		return nil, fmt.Errorf("PropertiesChanged changed properties are %T", sig.Body[1])
+	}
+	c := &{{changesType $iface}}{sender: sig.Sender, Path: sig.Path}
+	if c.Invalidated, ok = sig.Body[2].([]string); !ok {
+		return nil, fmt.Errorf("PropertiesChanged invalidated properties are %T", sig.Body[2])
+	}
+	{{- range $prop := $iface.Properties}}
+	{{- if $prop.Read}}
+	if v, ok := changed["{{$prop.Name}}"]; ok {
+		if sig := v.Signature().String(); sig != "{{$prop.Arg.Type.Signature}}" {
+			return nil, fmt.Errorf("%s.{{$prop.Name}} property: signature is %s rather than {{$prop.Arg.Type.Signature}}", {{ifaceNameConst $iface}}, sig)
+		}
+		{{- if argMapped $prop.Arg}}
+		var raw {{argRawType $prop.Arg}}
+		if err := v.Store(&raw); err != nil {
+			return nil, fmt.Errorf("%s.{{$prop.Name}} property: %w", {{ifaceNameConst $iface}}, err)
+		}
+		val, err := {{decodeArg $prop.Arg}}(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s.{{$prop.Name}} property: %w", {{ifaceNameConst $iface}}, err)
+		}
+		c.Changed.{{propType $prop}} = &val
+		{{- else}}
+		c.Changed.{{propType $prop}} = new({{argType $prop.Arg}})
+		if err := v.Store(c.Changed.{{propType $prop}}); err != nil {
+			return nil, fmt.Errorf("%s.{{$prop.Name}} property: %w", {{ifaceNameConst $iface}}, err)
+		}
+		{{- end}}
+	}
+	{{- end}}
+	{{- end}}
+	return c, nil
+}
+
+// {{changesWatchType $iface}} subscribes to changes of {{$iface.Name}} properties,
+// the returned channel is closed when ctx is done or conn is closed,
+// signals that cannot be decoded are skipped.
+func {{changesWatchType $iface}}(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *{{changesType $iface}}, error) {
+	sigc, err := watch(ctx, conn, newWatcher("org.freedesktop.DBus.Properties", "PropertiesChanged",
+		append(opts, withWatchArg0({{ifaceNameConst $iface}})),
+	))
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *{{changesType $iface}})
+	go func() {
+		defer close(ch)
+		for sig := range sigc {
+			c, err := {{changesParseType $iface}}(sig)
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return ch, nil
+}
+{{end}}
 {{range $signal := $iface.Signals}}
 // {{signalType $iface $signal}} represents {{$iface.Name}}.{{$signal.Name}} signal.
 {{- template "annotations" $signal}}
@@ -276,44 +760,164 @@ func (s *{{signalType $iface $signal}}) values() []interface{} {
 type {{signalBodyType $iface $signal}} struct {
 	{{joinSignalArgs $signal}}
 }
+
+// {{signalWatchType $iface $signal}} subscribes to {{$iface.Name}}.{{$signal.Name}} signal,
+// the returned channel is closed when ctx is done or conn is closed,
+// signals that cannot be decoded are skipped.
+func {{signalWatchType $iface $signal}}(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *{{signalType $iface $signal}}, error) {
+	sigc, err := watch(ctx, conn, newWatcher({{ifaceNameConst $iface}}, "{{$signal.Name}}", opts))
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *{{signalType $iface $signal}})
+	go func() {
+		defer close(ch)
+		for sig := range sigc {
+			s, err := LookupSignal(sig)
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- s.(*{{signalType $iface $signal}}):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// {{clientWatchType $signal}} subscribes to {{$iface.Name}}.{{$signal.Name}} signal emitted by the object,
+// see {{signalWatchType $iface $signal}}, conn has to be the connection the object belongs to.
+func (o *{{ifaceType $iface}}) {{clientWatchType $signal}}(ctx context.Context, conn *dbus.Conn, opts ...WatchOption) (<-chan *{{signalType $iface $signal}}, error) {
+	return {{signalWatchType $iface $signal}}(ctx, conn, append([]WatchOption{
+		WithWatchSender(o.object.Destination()), WithWatchPath(o.object.Path()),
+	}, opts...)...)
+}
+
+// {{signalOnType $iface $signal}} registers a handler of {{$iface.Name}}.{{$signal.Name}} signal,
+// it's called until the returned function is called or d is closed.
+func (d *SignalDispatcher) {{signalOnType $iface $signal}}(fn func(s *{{signalType $iface $signal}}), opts ...WatchOption) (unsubscribe func(), err error) {
+	return d.subscribe(&{{signalType $iface $signal}}{}, opts, func(s Signal) {
+		fn(s.(*{{signalType $iface $signal}}))
+	})
+}
 {{end}}
+{{- if $.Fakes}}
+{{- template "fake" .}}
+{{- end}}
 {{- end}}
 {{- end}}`
 
+// Print prints code for all the given interfaces into a single file.
 func Print(out io.Writer, ifaces []*token.Interface, opts ...PrintOption) error {
 	ctx, err := newContext(ifaces, opts...)
 	if err != nil {
 		return err
 	}
+	b, err := ctx.render(func(buf *bytes.Buffer) error {
+		if err := ctx.tpl.ExecuteTemplate(buf, "common", ctx); err != nil {
+			return err
+		}
+		for _, iface := range ifaces {
+			if err := ctx.executeIface(buf, iface); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(b)
+	return err
+}
 
-	ctx.addImport("github.com/godbus/dbus/v5")
+// File is a generated Go source file.
+type File struct {
+	Name string
+	Body []byte
+}
+
+// CommonFileName is the name of the file generated by PrintFiles
+// that contains code shared by all interfaces.
+const CommonFileName = "common.go"
 
-	if !ctx.ServerOnly {
-		ctx.addImport("context")
-		if haveSignals(ifaces) {
-			ctx.addImport("fmt")
-			ctx.addImport("errors")
+// PrintFiles prints code shared by all interfaces into CommonFileName
+// and code of each interface into a separate file named after it.
+func PrintFiles(ifaces []*token.Interface, opts ...PrintOption) ([]*File, error) {
+	ctx, err := newContext(ifaces, opts...)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ctx.render(func(buf *bytes.Buffer) error {
+		return ctx.tpl.ExecuteTemplate(buf, "common", ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*File, 0, len(ifaces)+1)
+	files = append(files, &File{Name: CommonFileName, Body: b})
+	for _, iface := range ifaces {
+		iface := iface
+		b, err := ctx.render(func(buf *bytes.Buffer) error {
+			return ctx.executeIface(buf, iface)
+		})
+		if err != nil {
+			return nil, err
 		}
+		files = append(files, &File{Name: ifaceFileName(iface), Body: b})
+	}
+	return files, nil
+}
+
+// ifaceFileName returns the lowercased interface name
+// avoiding the _test suffix that has special meaning.
+func ifaceFileName(iface *token.Interface) string {
+	name := strings.ToLower(iface.Name)
+	if strings.HasSuffix(name, "_test") {
+		name += "_"
 	}
+	return name + ".go"
+}
+
+func (ctx *context) executeIface(buf *bytes.Buffer, iface *token.Interface) error {
+	return ctx.tpl.ExecuteTemplate(buf, "iface", struct {
+		Interface *token.Interface
+		Context   *context
+	}{iface, ctx})
+}
 
+// render renders a file body with the given function and prepends
+// the header to it that contains only imports used by the body.
+func (ctx *context) render(fn func(buf *bytes.Buffer) error) ([]byte, error) {
+	ctx.Imports = nil
+	var body bytes.Buffer
+	if err := fn(&body); err != nil {
+		return nil, err
+	}
 	var buf bytes.Buffer
-	if err = template.Must(ctx.tpl.Parse(clientTpl)).Execute(&buf, ctx); err != nil {
-		return err
+	if err := ctx.tpl.ExecuteTemplate(&buf, "header", ctx); err != nil {
+		return nil, err
 	}
-	if ctx.gofmt {
-		fset := gotoken.NewFileSet()
-		file, err := goparser.ParseFile(fset, "", buf.Bytes(), goparser.ParseComments)
-		if err != nil {
-			// TODO: print helpful message
-			// if _, ok := err.(scanner.ErrorList); ok {
-			// 	return errors.New("unable to parse generated code")
-			// }
-			return err
-		}
-		return goformat.Node(out, fset, file)
+	buf.Write(body.Bytes())
+	if !ctx.gofmt {
+		return buf.Bytes(), nil
 	}
-	_, err = out.Write(buf.Bytes())
-	return err
+
+	fset := gotoken.NewFileSet()
+	file, err := goparser.ParseFile(fset, "", buf.Bytes(), goparser.ParseComments)
+	if err != nil {
+		// TODO: print helpful message
+		// if _, ok := err.(scanner.ErrorList); ok {
+		// 	return errors.New("unable to parse generated code")
+		// }
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err = goformat.Node(&out, fset, file); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
 }
 
 func haveSignals(ifaces []*token.Interface) bool {
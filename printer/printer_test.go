@@ -2,8 +2,12 @@ package printer
 
 import (
 	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/amenzhinsky/dbus-codegen-go/parser"
 	"github.com/amenzhinsky/dbus-codegen-go/token"
 )
 
@@ -36,4 +40,246 @@ func TestIfaceName(t *testing.T) {
 			t.Errorf("ifaceType(%q) = %q, want %q", name, have, want)
 		}
 	}
+
+	p = &context{prefixes: []string{"org.example", "org.example.Foo.", "Bar", ""}}
+	for name, want := range map[string]string{
+		"org.example.Foo.Bar": "Bar",              // the longest prefix
+		"org.example.Foo":     "Foo",              // equal to a prefix
+		"org.examples.Foo":    "Org_Examples_Foo", // not followed by a dot
+		"com.example.Bar":     "Com_Example_Bar",  // not at the beginning
+	} {
+		if have := p.tplIfaceType(&token.Interface{
+			Name: name,
+		}); have != want {
+			t.Errorf("ifaceType(%q) = %q, want %q", name, have, want)
+		}
+	}
+}
+
+func TestGoType(t *testing.T) {
+	p := &context{}
+	for sig, want := range map[string]string{
+		"y":        "byte",
+		"b":        "bool",
+		"h":        "dbus.UnixFD",
+		"o":        "dbus.ObjectPath",
+		"v":        "dbus.Variant",
+		"g":        "dbus.Signature",
+		"aai":      "[][]int32",
+		"aaaa{sb}": "[][][]map[string]bool",
+		"a{yv}":    "map[byte]dbus.Variant",
+		"(ybv)":    "struct {V0 byte;V1 bool;V2 dbus.Variant}",
+	} {
+		typ := parseType(t, sig)
+		if have := p.goType(typ); have != want {
+			t.Errorf("goType(%q) = %q, want %q", sig, have, want)
+		}
+	}
+}
+
+// parseType parses the given signature with the parser
+// package to avoid constructing type trees by hand.
+func parseType(t *testing.T, sig string) *token.Type {
+	t.Helper()
+	ifaces, err := parser.Parse([]byte(`<node><interface name="org.example.Test">` +
+		`<property name="Value" type="` + sig + `" access="read"/>` +
+		`</interface></node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ifaces[0].Properties[0].Arg.Type
+}
+
+func TestStructNames(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Foo">
+		<method name="List">
+			<arg type="a(so(ib))" direction="out"/>
+		</method>
+		<method name="Get">
+			<arg type="(so(ib))" direction="out"/>
+			<arg type="(ss)" direction="out"/>
+			<annotation name="org.qtproject.QtDBus.QtTypeName.Out1" value="QList&lt;Ns::Pair&gt;"/>
+		</method>
+		<method name="Set">
+			<arg type="(so(ib))" direction="in"/>
+			<annotation name="org.golang.StructFields.In0" value="name,path,info"/>
+		</method>
+		<property name="Entry" type="(ii)" access="read">
+			<annotation name="org.golang.StructName" value="Entry"/>
+		</property>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := newContext(ifaces, WithStructFields(map[string][]string{
+		"(ib)": {"Code", "Ok"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for typ, want := range map[*token.Type]string{
+		ifaces[0].Methods[0].Out[0].Type:                "[]Org_Example_Foo_ListOut0",
+		ifaces[0].Methods[0].Out[0].Type.Elem.Fields[2]: "Org_Example_Foo_ListOut0_V2",
+		ifaces[0].Methods[1].Out[0].Type:                "Org_Example_Foo_ListOut0",
+		ifaces[0].Methods[1].Out[1].Type:                "Pair",
+		ifaces[0].Methods[2].In[0].Type:                 "Org_Example_Foo_SetIn0",
+		ifaces[0].Properties[0].Arg.Type:                "Entry",
+	} {
+		if have := ctx.goType(typ); have != want {
+			t.Errorf("goType(%q) = %q, want %q", typ.Signature, have, want)
+		}
+	}
+	for name, want := range map[string]string{
+		"Org_Example_Foo_ListOut0":    "V0,V1,V2",
+		"Org_Example_Foo_SetIn0":      "Name,Path,Info",
+		"Org_Example_Foo_ListOut0_V2": "Code,Ok",
+	} {
+		var have string
+		for _, st := range ctx.structList {
+			if st.Name == name {
+				have = strings.Join(st.Fields, ",")
+			}
+		}
+		if have != want {
+			t.Errorf("%s fields = %q, want %q", name, have, want)
+		}
+	}
+}
+
+func TestStructNamesConflict(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Foo">
+		<method name="List">
+			<arg type="a(ss)" direction="out"/>
+			<annotation name="org.qtproject.QtDBus.QtTypeName.Out0" value="QList&lt;Item&gt;"/>
+		</method>
+		<method name="Get">
+			<arg type="(ii)" direction="out"/>
+			<annotation name="org.qtproject.QtDBus.QtTypeName.Out0" value="Item"/>
+		</method>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := newContext(ifaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for typ, want := range map[*token.Type]string{
+		ifaces[0].Methods[0].Out[0].Type: "[]Item",
+		ifaces[0].Methods[1].Out[0].Type: "Item2",
+	} {
+		if have := ctx.goType(typ); have != want {
+			t.Errorf("goType(%q) = %q, want %q", typ.Signature, have, want)
+		}
+	}
+
+	// explicit names are never changed
+	ifaces, err = parser.Parse([]byte(`<node>
+	<interface name="org.example.Foo">
+		<method name="List">
+			<arg type="(ss)" direction="out"/>
+			<arg type="(ii)" direction="out"/>
+			<annotation name="org.golang.StructName.Out0" value="Item"/>
+			<annotation name="org.golang.StructName.Out1" value="Item"/>
+		</method>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `org.example.Foo: struct name "Item" is used for both "(ss)" and "(ii)" signatures`
+	if _, err = newContext(ifaces); err == nil || err.Error() != want {
+		t.Errorf("newContext error = %v, want %q", err, want)
+	}
+}
+
+func TestPrintFiles(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Foo">
+		<method name="Bar"/>
+	</interface>
+	<interface name="org.example.Baz_Test">
+		<signal name="Changed"/>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := PrintFiles(ifaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{CommonFileName, "org.example.foo.go", "org.example.baz_test_.go"}
+	if len(files) != len(want) {
+		t.Fatalf("len(files) = %d, want %d", len(files), len(want))
+	}
+	for i := range files {
+		if files[i].Name != want[i] {
+			t.Errorf("files[%d].Name = %q, want %q", i, files[i].Name, want[i])
+		}
+	}
+	if !bytes.Contains(files[0].Body, []byte("func LookupSignal(")) {
+		t.Errorf("%s doesn't contain LookupSignal", files[0].Name)
+	}
+	if bytes.Contains(files[1].Body, []byte(`"errors"`)) {
+		t.Errorf("%s imports unused errors package", files[1].Name)
+	}
+}
+
+func TestIfaceXML(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Foo">
+		<method name="Do">
+			<arg name="what" type="s" direction="in"/>
+			<arg type="a{sv}" direction="out"/>
+			<annotation name="org.freedesktop.DBus.Deprecated" value="true"/>
+		</method>
+		<method name="Split">
+			<arg name="text" type="s" direction="in"/>
+			<arg name="parts" type="as" direction="out"/>
+			<arg name="sep" type="s" direction="in"/>
+		</method>
+		<signal name="Done">
+			<arg name="result" type="(iu)"/>
+		</signal>
+		<property name="Name" type="s" access="read"/>
+		<property name="Secret" type="s" access="write"/>
+		<property name="Powered" type="b" access="readwrite"/>
+		<annotation name="org.example.Note" value="&quot;quoted&quot; &amp; ` + "`ticked`" + `"/>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := newContext(ifaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lit, err := ctx.tplIfaceXML(ifaces[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := strconv.Unquote(lit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parser.Parse([]byte("<node>" + s + "</node>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, ifaces) {
+		t.Errorf("introspection data doesn't match the original:\n%s", s)
+	}
 }
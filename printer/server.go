@@ -0,0 +1,539 @@
+package printer
+
+// serverTpl is a server-side runtime that tracks interfaces exported
+// on each path to serve org.freedesktop.DBus.Properties,
+// org.freedesktop.DBus.Introspectable and
+// org.freedesktop.DBus.ObjectManager interfaces for all of them.
+const serverTpl = `{{define "server"}}{{import "context"}}{{import "errors"}}{{import "sync"}}{{import "sort"}}{{import "strings"}}{{import "github.com/godbus/dbus/v5"}}
+// Errors returned by the org.freedesktop.DBus.Properties implementation.
+var (
+	ErrUnknownObject     = dbus.NewError("org.freedesktop.DBus.Error.UnknownObject", []interface{}{"Unknown object"})
+	ErrUnknownInterface  = dbus.NewError("org.freedesktop.DBus.Error.UnknownInterface", []interface{}{"Unknown interface"})
+	ErrUnknownProperty   = dbus.NewError("org.freedesktop.DBus.Error.UnknownProperty", []interface{}{"Unknown property"})
+	ErrPropertyReadOnly  = dbus.NewError("org.freedesktop.DBus.Error.PropertyReadOnly", []interface{}{"Property is read-only"})
+	ErrPropertyWriteOnly = dbus.NewError("org.freedesktop.DBus.Error.AccessDenied", []interface{}{"Property is write-only"})
+)
+
+// exportedIface is an interface exported with one of Export functions.
+type exportedIface struct {
+	xml   string                       // introspection data
+	props map[string]*exportedProperty // by property name
+}
+
+// exportedProperty is a property of an exported object,
+// get is nil for write-only and set for read-only ones.
+type exportedProperty struct {
+	get func(ctx context.Context) (interface{}, *dbus.Error)
+	set func(ctx context.Context, value dbus.Variant) *dbus.Error
+}
+{{- if .ServerContext}}
+
+// CallInfo describes a method call being handled by a server, property
+// accesses are described by org.freedesktop.DBus.Properties calls.
+type CallInfo struct {
+	Sender    string // unique name of the caller
+	Path      dbus.ObjectPath
+	Interface string
+	Member    string
+	Flags     dbus.Flags
+	Serial    uint32
+	Message   *dbus.Message
+}
+
+type callInfoKey struct{}
+
+// CallInfoFromContext returns information about the call stored in ctx
+// passed to server methods, ok is false when ctx doesn't carry it,
+// e.g. when properties are read to announce a newly exported interface.
+func CallInfoFromContext(ctx context.Context) (info *CallInfo, ok bool) {
+	info, ok = ctx.Value(callInfoKey{}).(*CallInfo)
+	return info, ok
+}
+
+// newCallContext returns a context carrying CallInfo of the message,
+// it's never canceled since calls cannot be abandoned by callers.
+func newCallContext(msg dbus.Message) context.Context {
+	info := &CallInfo{
+		Flags:   msg.Flags,
+		Serial:  msg.Serial(),
+		Message: &msg,
+	}
+	info.Sender, _ = msg.Headers[dbus.FieldSender].Value().(string)
+	info.Path, _ = msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	info.Interface, _ = msg.Headers[dbus.FieldInterface].Value().(string)
+	info.Member, _ = msg.Headers[dbus.FieldMember].Value().(string)
+	return context.WithValue(context.Background(), callInfoKey{}, info)
+}
+{{- end}}
+
+// exports tracks exported interfaces by connection,
+// object path and interface name along with object managers,
+// conns holds channels closed once connections are released.
+var exports = struct {
+	sync.Mutex
+	objects  map[*dbus.Conn]map[dbus.ObjectPath]map[string]*exportedIface
+	managers map[*dbus.Conn]map[dbus.ObjectPath]struct{}
+	conns    map[*dbus.Conn]chan struct{}
+}{
+	objects:  map[*dbus.Conn]map[dbus.ObjectPath]map[string]*exportedIface{},
+	managers: map[*dbus.Conn]map[dbus.ObjectPath]struct{}{},
+	conns:    map[*dbus.Conn]chan struct{}{},
+}
+
+// trackConn starts tracking the connection dropping everything
+// exported on it once it's closed, the lock has to be held.
+func trackConn(conn *dbus.Conn) {
+	if _, ok := exports.conns[conn]; ok {
+		return
+	}
+	released := make(chan struct{})
+	exports.conns[conn] = released
+	go func() {
+		select {
+		case <-conn.Context().Done():
+			exports.Lock()
+			if exports.conns[conn] == released {
+				delete(exports.objects, conn)
+				delete(exports.managers, conn)
+				delete(exports.conns, conn)
+			}
+			exports.Unlock()
+		case <-released:
+		}
+	}()
+}
+
+// releaseConn stops tracking the connection when nothing
+// is exported on it anymore, the lock has to be held.
+func releaseConn(conn *dbus.Conn) {
+	if len(exports.objects[conn]) != 0 || len(exports.managers[conn]) != 0 {
+		return
+	}
+	delete(exports.objects, conn)
+	delete(exports.managers, conn)
+	if released, ok := exports.conns[conn]; ok {
+		close(released)
+		delete(exports.conns, conn)
+	}
+}
+
+const (
+	ifacePeer           = "org.freedesktop.DBus.Peer"
+	ifaceIntrospectable = "org.freedesktop.DBus.Introspectable"
+	ifaceProperties     = "org.freedesktop.DBus.Properties"
+	ifaceObjectManager  = "org.freedesktop.DBus.ObjectManager"
+)
+
+// headerXML contains standard interfaces implemented by all objects.
+const headerXML = ` + "`" + `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+<node>
+	<interface name="org.freedesktop.DBus.Peer">
+		<method name="Ping"></method>
+		<method name="GetMachineId">
+			<arg name="machine_uuid" type="s" direction="out"></arg>
+		</method>
+	</interface>
+	<interface name="org.freedesktop.DBus.Introspectable">
+		<method name="Introspect">
+			<arg name="xml_data" type="s" direction="out"></arg>
+		</method>
+	</interface>
+` + "`" + `
+
+// propertiesXML is included when any of the object's interfaces has properties.
+const propertiesXML = ` + "`" + `	<interface name="org.freedesktop.DBus.Properties">
+		<method name="Get">
+			<arg name="interface_name" type="s" direction="in"></arg>
+			<arg name="property_name" type="s" direction="in"></arg>
+			<arg name="value" type="v" direction="out"></arg>
+		</method>
+		<method name="GetAll">
+			<arg name="interface_name" type="s" direction="in"></arg>
+			<arg name="props" type="a{sv}" direction="out"></arg>
+		</method>
+		<method name="Set">
+			<arg name="interface_name" type="s" direction="in"></arg>
+			<arg name="property_name" type="s" direction="in"></arg>
+			<arg name="value" type="v" direction="in"></arg>
+		</method>
+		<signal name="PropertiesChanged">
+			<arg name="interface_name" type="s"></arg>
+			<arg name="changed_properties" type="a{sv}"></arg>
+			<arg name="invalidated_properties" type="as"></arg>
+		</signal>
+	</interface>
+` + "`" + `
+
+// objectManagerXML is included by object managers.
+const objectManagerXML = ` + "`" + `	<interface name="org.freedesktop.DBus.ObjectManager">
+		<method name="GetManagedObjects">
+			<arg name="objects" type="a{oa{sa{sv}}}" direction="out"></arg>
+		</method>
+		<signal name="InterfacesAdded">
+			<arg name="object" type="o"></arg>
+			<arg name="interfaces" type="a{sa{sv}}"></arg>
+		</signal>
+		<signal name="InterfacesRemoved">
+			<arg name="object" type="o"></arg>
+			<arg name="interfaces" type="as"></arg>
+		</signal>
+	</interface>
+` + "`" + `
+
+// exportIface registers the named interface on the path exporting
+// org.freedesktop.DBus.Introspectable and org.freedesktop.DBus.Properties
+// interfaces there when needed and announces it with InterfacesAdded
+// signal when the path is managed by an object manager, standard
+// interfaces are not tracked to avoid overriding their implementations.
+func exportIface(conn *dbus.Conn, path dbus.ObjectPath, iface string, v *exportedIface) error {
+	switch iface {
+	case ifacePeer, ifaceIntrospectable, ifaceProperties:
+		return nil
+	}
+	manager, err := registerIface(conn, path, iface, v)
+	if err != nil || manager == "" {
+		return err
+	}
+	props, _ := v.properties(context.Background(), false)
+	return conn.Emit(manager, ifaceObjectManager+".InterfacesAdded", path, map[string]map[string]dbus.Variant{
+		iface: props,
+	})
+}
+
+// registerIface adds the interface to exports returning
+// the path of the object manager managing the path if any.
+func registerIface(conn *dbus.Conn, path dbus.ObjectPath, iface string, v *exportedIface) (dbus.ObjectPath, error) {
+	exports.Lock()
+	defer exports.Unlock()
+	if exports.objects[conn] == nil {
+		exports.objects[conn] = map[dbus.ObjectPath]map[string]*exportedIface{}
+		trackConn(conn)
+	}
+	if exports.objects[conn][path] == nil {
+		if err := conn.ExportMethodTable(map[string]interface{}{
+			"Introspect": func() (string, *dbus.Error) {
+				return introspectPath(conn, path), nil
+			},
+		}, path, ifaceIntrospectable); err != nil {
+			return "", err
+		}
+		exports.objects[conn][path] = map[string]*exportedIface{}
+	}
+	if len(v.props) != 0 && !hasProperties(exports.objects[conn][path]) {
+		// methods are exported for the subtree like interfaces
+		// of objects, so calls on other paths are rejected
+		if err := conn.ExportSubtreeMethodTable(map[string]interface{}{
+			"Get": func(msg dbus.Message, iface, name string) (dbus.Variant, *dbus.Error) {
+				if err := checkObjectPath(msg, path); err != nil {
+					return dbus.Variant{}, err
+				}
+				prop, err := lookupProperty(conn, path, iface, name)
+				if err != nil {
+					return dbus.Variant{}, err
+				}
+				return getProperty({{template "callContext" .}}, prop)
+			},
+			"GetAll": func(msg dbus.Message, iface string) (map[string]dbus.Variant, *dbus.Error) {
+				if err := checkObjectPath(msg, path); err != nil {
+					return nil, err
+				}
+				return getAllProperties({{template "callContext" .}}, conn, path, iface)
+			},
+			"Set": func(msg dbus.Message, iface, name string, value dbus.Variant) *dbus.Error {
+				if err := checkObjectPath(msg, path); err != nil {
+					return err
+				}
+				prop, err := lookupProperty(conn, path, iface, name)
+				if err != nil {
+					return err
+				}
+				if prop.set == nil {
+					return ErrPropertyReadOnly
+				}
+				return prop.set({{template "callContext" .}}, value)
+			},
+		}, path, ifaceProperties); err != nil {
+			return "", err
+		}
+	}
+	exports.objects[conn][path][iface] = v
+	return managerOf(conn, path), nil
+}
+
+// unexportIface removes the named interface from the path unexporting
+// standard interfaces that are not needed anymore and announces it
+// with InterfacesRemoved signal when the path is managed.
+func unexportIface(conn *dbus.Conn, path dbus.ObjectPath, iface string) error {
+	manager, ok, err := unregisterIface(conn, path, iface)
+	if err != nil || !ok || manager == "" {
+		return err
+	}
+	return conn.Emit(manager, ifaceObjectManager+".InterfacesRemoved", path, []string{iface})
+}
+
+// unregisterIface removes the interface from exports returning the path
+// of the object manager managing the path if any, ok is false when
+// the interface hasn't been registered.
+func unregisterIface(conn *dbus.Conn, path dbus.ObjectPath, iface string) (manager dbus.ObjectPath, ok bool, err error) {
+	exports.Lock()
+	defer exports.Unlock()
+	ifaces := exports.objects[conn][path]
+	if _, ok = ifaces[iface]; !ok {
+		return "", false, nil
+	}
+	delete(ifaces, iface)
+	manager = managerOf(conn, path)
+	if !hasProperties(ifaces) {
+		if err = conn.Export(nil, path, ifaceProperties); err != nil {
+			return "", false, err
+		}
+	}
+	if len(ifaces) != 0 {
+		return manager, true, nil
+	}
+	delete(exports.objects[conn], path)
+	releaseConn(conn)
+	return manager, true, conn.Export(nil, path, ifaceIntrospectable)
+}
+
+func hasProperties(ifaces map[string]*exportedIface) bool {
+	for _, iface := range ifaces {
+		if len(iface.props) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// introspectPath returns introspection data of all interfaces exported
+// on the path, child nodes are made up of other exported paths.
+func introspectPath(conn *dbus.Conn, path dbus.ObjectPath) string {
+	exports.Lock()
+	defer exports.Unlock()
+	ifaces := exports.objects[conn][path]
+
+	var b strings.Builder
+	b.WriteString(headerXML)
+	if hasProperties(ifaces) {
+		b.WriteString(propertiesXML)
+	}
+	names := make([]string, 0, len(ifaces))
+	for name := range ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString(ifaces[name].xml)
+	}
+
+	prefix := string(path) + "/"
+	if path == "/" {
+		prefix = "/"
+	}
+	children := map[string]struct{}{}
+	for p := range exports.objects[conn] {
+		if isDescendant(p, path) {
+			children[strings.SplitN(string(p[len(prefix):]), "/", 2)[0]] = struct{}{}
+		}
+	}
+	names = names[:0]
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString("\t<node name=\"" + name + "\"></node>\n")
+	}
+	b.WriteString("</node>")
+	return b.String()
+}
+
+// checkObjectPath returns ErrUnknownObject when the message
+// is sent to a path other than the exported one.
+func checkObjectPath(msg dbus.Message, path dbus.ObjectPath) *dbus.Error {
+	if p, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath); p != path {
+		return ErrUnknownObject
+	}
+	return nil
+}
+
+func lookupProperty(conn *dbus.Conn, path dbus.ObjectPath, iface, name string) (*exportedProperty, *dbus.Error) {
+	exports.Lock()
+	defer exports.Unlock()
+	v, ok := exports.objects[conn][path][iface]
+	if !ok {
+		return nil, ErrUnknownInterface
+	}
+	prop, ok := v.props[name]
+	if !ok {
+		return nil, ErrUnknownProperty
+	}
+	return prop, nil
+}
+
+func getProperty(ctx context.Context, prop *exportedProperty) (dbus.Variant, *dbus.Error) {
+	if prop.get == nil {
+		return dbus.Variant{}, ErrPropertyWriteOnly
+	}
+	v, err := prop.get(ctx)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	return dbus.MakeVariant(v), nil
+}
+
+// getAllProperties returns values of all readable properties of the interface.
+func getAllProperties(ctx context.Context, conn *dbus.Conn, path dbus.ObjectPath, iface string) (map[string]dbus.Variant, *dbus.Error) {
+	exports.Lock()
+	v, ok := exports.objects[conn][path][iface]
+	exports.Unlock()
+	if !ok {
+		return nil, ErrUnknownInterface
+	}
+	return v.properties(ctx, true)
+}
+
+// properties returns values of all readable properties implemented by
+// the server, when strict is false properties failing to be read
+// are omitted instead of returning an error.
+func (v *exportedIface) properties(ctx context.Context, strict bool) (map[string]dbus.Variant, *dbus.Error) {
+	values := make(map[string]dbus.Variant, len(v.props))
+	for name, prop := range v.props {
+		if prop.get == nil {
+			continue
+		}
+		value, err := getProperty(ctx, prop)
+		if err == ErrUnknownProperty || err != nil && !strict {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// ServeObjectManager exports org.freedesktop.DBus.ObjectManager interface
+// on the path reporting interfaces exported below it with Export functions
+// along with their properties, InterfacesAdded and InterfacesRemoved
+// signals are emitted automatically when they're exported or unexported.
+func ServeObjectManager(conn *dbus.Conn, path dbus.ObjectPath) error {
+	if err := conn.ExportMethodTable(map[string]interface{}{
+		"GetManagedObjects": func({{template "callMsg" .}}) (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+			return getManagedObjects({{template "callContext" .}}, conn, path)
+		},
+	}, path, ifaceObjectManager); err != nil {
+		return err
+	}
+	exports.Lock()
+	if exports.managers[conn] == nil {
+		exports.managers[conn] = map[dbus.ObjectPath]struct{}{}
+		trackConn(conn)
+	}
+	exports.managers[conn][path] = struct{}{}
+	exports.Unlock()
+	return exportIface(conn, path, ifaceObjectManager, &exportedIface{
+		xml: objectManagerXML,
+	})
+}
+
+// StopObjectManager unexports the object manager served on the path.
+func StopObjectManager(conn *dbus.Conn, path dbus.ObjectPath) error {
+	exports.Lock()
+	delete(exports.managers[conn], path)
+	releaseConn(conn)
+	exports.Unlock()
+	if err := unexportIface(conn, path, ifaceObjectManager); err != nil {
+		return err
+	}
+	return conn.Export(nil, path, ifaceObjectManager)
+}
+
+// managerOf returns path of the closest object manager
+// above the given path, the lock has to be held.
+func managerOf(conn *dbus.Conn, path dbus.ObjectPath) dbus.ObjectPath {
+	var manager dbus.ObjectPath
+	for p := range exports.managers[conn] {
+		if len(p) > len(manager) && isDescendant(path, p) {
+			manager = p
+		}
+	}
+	return manager
+}
+
+// isDescendant reports whether the path is below the given one.
+func isDescendant(path, parent dbus.ObjectPath) bool {
+	if parent == "/" {
+		return path != "/"
+	}
+	return strings.HasPrefix(string(path), string(parent)+"/")
+}
+
+// getManagedObjects returns interfaces exported below the manager's path.
+func getManagedObjects(ctx context.Context, conn *dbus.Conn, manager dbus.ObjectPath) (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	exports.Lock()
+	objects := map[dbus.ObjectPath]map[string]*exportedIface{}
+	for path, ifaces := range exports.objects[conn] {
+		if !isDescendant(path, manager) {
+			continue
+		}
+		objects[path] = make(map[string]*exportedIface, len(ifaces))
+		for name, v := range ifaces {
+			objects[path][name] = v
+		}
+	}
+	exports.Unlock()
+
+	values := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant, len(objects))
+	for path, ifaces := range objects {
+		values[path] = make(map[string]map[string]dbus.Variant, len(ifaces))
+		for name, v := range ifaces {
+			props, err := v.properties(ctx, true)
+			if err != nil {
+				return nil, err
+			}
+			values[path][name] = props
+		}
+	}
+	return values, nil
+}
+
+// emitPropertiesChanged emits org.freedesktop.DBus.Properties.PropertiesChanged signal.
+func emitPropertiesChanged(
+	conn *dbus.Conn, path dbus.ObjectPath, iface string,
+	changed map[string]dbus.Variant, invalidated []string,
+) error {
+	if changed == nil {
+		changed = map[string]dbus.Variant{}
+	}
+	if invalidated == nil {
+		invalidated = []string{}
+	}
+	return conn.Emit(path, ifaceProperties+".PropertiesChanged", iface, changed, invalidated)
+}
+
+// storeProperty stores the given value into v
+// when it has the expected D-Bus signature.
+func storeProperty(value dbus.Variant, sig string, v interface{}) *dbus.Error {
+	if value.Signature().String() != sig {
+		return invalidArgs(errors.New("Invalid property type " + value.Signature().String() + ", want " + sig))
+	}
+	if err := value.Store(v); err != nil {
+		return invalidArgs(err)
+	}
+	return nil
+}
+
+// invalidArgs returns an InvalidArgs error with the given error's message,
+// it's also returned when arguments cannot be converted to mapped types.
+func invalidArgs(err error) *dbus.Error {
+	return dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []interface{}{err.Error()})
+}
+{{end}}
+
+{{- /* callMsg declares the message argument injected into exported methods */ -}}
+{{- define "callMsg"}}{{if .ServerContext}}msg dbus.Message, {{end}}{{end}}
+
+{{- /* callContext is the context passed to server methods */ -}}
+{{- define "callContext"}}{{if .ServerContext}}newCallContext(msg){{else}}context.Background(){{end}}{{end}}`
@@ -0,0 +1,297 @@
+package printer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/amenzhinsky/dbus-codegen-go/token"
+)
+
+// Annotations that name struct types of arguments and properties and
+// their fields, method and signal annotations are suffixed with In<N>
+// or Out<N> where N is the argument index, e.g. org.golang.StructName.Out0.
+//
+// Fields are listed comma-separated, e.g. "Name,Description".
+const (
+	annotationStructName   = "org.golang.StructName"
+	annotationStructFields = "org.golang.StructFields"
+	annotationQtTypeName   = "org.qtproject.QtDBus.QtTypeName"
+)
+
+// structType is a named Go struct generated for a D-Bus struct signature.
+type structType struct {
+	Name   string
+	Type   *token.Type
+	Fields []string
+	owner  *token.Interface
+}
+
+// qtTypeRegexp extracts the innermost type name from
+// qt type names like QList<Namespace::TypeName>.
+var qtTypeRegexp = regexp.MustCompile(`(?:^|[<:])([A-Za-z_][A-Za-z0-9_]*)>*$`)
+
+// collectStructs names all struct types used by the given interfaces
+// deduplicating them by signature and field names, annotated names
+// take precedence. Types of mapped arguments are not generated.
+func (ctx *context) collectStructs() error {
+	ctx.structs = map[string]*structType{}
+	ctx.structTypes = map[*token.Type]*structType{}
+	for _, annotated := range []bool{true, false} {
+		for _, iface := range ctx.Interfaces {
+			for _, method := range iface.Methods {
+				owner := iface.Name + "." + method.Name + " method"
+				for i, arg := range method.In {
+					if ctx.argTypes[arg] != nil {
+						continue
+					}
+					suffix := "In" + strconv.Itoa(i)
+					if err := ctx.addStruct(iface, arg.Type, annotated,
+						method.Annotations, suffix, ctx.tplMethodType(method)+suffix, owner,
+					); err != nil {
+						return err
+					}
+				}
+				for i, arg := range method.Out {
+					if ctx.argTypes[arg] != nil {
+						continue
+					}
+					suffix := "Out" + strconv.Itoa(i)
+					if err := ctx.addStruct(iface, arg.Type, annotated,
+						method.Annotations, suffix, ctx.tplMethodType(method)+suffix, owner,
+					); err != nil {
+						return err
+					}
+				}
+			}
+			for _, prop := range iface.Properties {
+				if ctx.argTypes[prop.Arg] != nil {
+					continue
+				}
+				if err := ctx.addStruct(iface, prop.Arg.Type, annotated,
+					prop.Annotations, "", ctx.tplPropType(prop)+"Property",
+					iface.Name+"."+prop.Name+" property",
+				); err != nil {
+					return err
+				}
+			}
+			for _, signal := range iface.Signals {
+				for i, arg := range signal.Args {
+					if ctx.argTypes[arg] != nil {
+						continue
+					}
+					if err := ctx.addStruct(iface, arg.Type, annotated,
+						signal.Annotations, signalArgSuffix(signal, i), ctx.signalName(signal)+"Arg"+strconv.Itoa(i),
+						iface.Name+"."+signal.Name+" signal",
+					); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// signalArgSuffix returns the suffix of annotations of the signal's i-th
+// argument, signal arguments are annotated either as In or Out.
+func signalArgSuffix(signal *token.Signal, i int) string {
+	suffix := "Out" + strconv.Itoa(i)
+	if !hasAnnotationSuffix(signal.Annotations, suffix) {
+		suffix = "In" + strconv.Itoa(i)
+	}
+	return suffix
+}
+
+func hasAnnotationSuffix(annotations []*token.Annotation, suffix string) bool {
+	for _, annotation := range annotations {
+		if strings.HasSuffix(annotation.Name, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// findAnnotation returns value of the named annotation for the argument
+// identified by suffix, that is empty for properties.
+func findAnnotation(annotations []*token.Annotation, name, suffix string) (string, bool) {
+	if suffix != "" {
+		name += "." + suffix
+	}
+	for _, annotation := range annotations {
+		if annotation.Name == name {
+			return annotation.Value, true
+		}
+	}
+	return "", false
+}
+
+// structName returns struct name provided by annotations, explicit is
+// false when it's derived from a qt type name that may be shared
+// by different types, e.g. QList<Item> and QMap<QString, Item>.
+func structName(annotations []*token.Annotation, suffix string) (name string, explicit bool) {
+	if v, ok := findAnnotation(annotations, annotationStructName, suffix); ok {
+		return v, true
+	}
+	if v, ok := findAnnotation(annotations, annotationQtTypeName, suffix); ok {
+		if m := qtTypeRegexp.FindStringSubmatch(v); m != nil {
+			return strings.Title(m[1]), false
+		}
+	}
+	return "", false
+}
+
+// addStruct registers the outermost struct of typ and all structs
+// nested in it, when annotated is true only structs with names
+// provided by annotations are registered, otherwise the name
+// is made up of the interface type name and member, owner
+// describes the D-Bus member in error messages.
+func (ctx *context) addStruct(
+	iface *token.Interface, typ *token.Type, annotated bool,
+	annotations []*token.Annotation, suffix, member, owner string,
+) error {
+	name, explicit := structName(annotations, suffix)
+	if annotated && name == "" || !annotated && name != "" {
+		return nil
+	}
+	if name == "" {
+		name = ctx.joinTypeName(ctx.tplIfaceType(iface), member)
+	}
+	if !identRegexp.MatchString(name) {
+		return fmt.Errorf("%s: struct name %q is not a valid identifier", iface.Name, name)
+	}
+	var fields []string
+	if v, ok := findAnnotation(annotations, annotationStructFields, suffix); ok {
+		fields = strings.Split(v, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+	}
+	return ctx.walkStructs(iface, typ, name, fields, owner, explicit)
+}
+
+// walkStructs registers the outermost struct found in typ with
+// the given name and fields that may be nil to use the default ones,
+// explicit names provided by annotations are never changed, others are
+// suffixed with a number when conflicting with another identifier.
+func (ctx *context) walkStructs(
+	iface *token.Interface, typ *token.Type, name string, fields []string,
+	owner string, explicit bool,
+) error {
+	switch typ.Kind {
+	case token.KindArray, token.KindDict:
+		return ctx.walkStructs(iface, typ.Elem, name, fields, owner, explicit)
+	case token.KindStruct:
+	default:
+		return nil
+	}
+	fields, err := ctx.structFields(iface, typ, fields)
+	if err != nil {
+		return err
+	}
+	key := typ.Signature + " " + strings.Join(fields, ",")
+	if st, ok := ctx.structs[key]; ok {
+		ctx.structTypes[typ] = st
+		return ctx.walkNestedStructs(iface, typ, st, owner)
+	}
+	if explicit {
+		for _, st := range ctx.structList {
+			if st.Name == name {
+				return fmt.Errorf("%s: struct name %q is used for both %q and %q signatures",
+					iface.Name, name, st.Type.Signature, typ.Signature)
+			}
+		}
+	}
+	name, err = ctx.claimStruct(owner, typ, name, explicit)
+	if err != nil {
+		return err
+	}
+	st := &structType{
+		Name:   name,
+		Type:   typ,
+		Fields: fields,
+		owner:  iface,
+	}
+	ctx.structs[key] = st
+	ctx.structTypes[typ] = st
+	ctx.structList = append(ctx.structList, st)
+	return ctx.walkNestedStructs(iface, typ, st, owner)
+}
+
+func (ctx *context) walkNestedStructs(iface *token.Interface, typ *token.Type, st *structType, owner string) error {
+	for i, field := range typ.Fields {
+		if err := ctx.walkStructs(iface, field,
+			ctx.joinTypeName(st.Name, st.Fields[i]), nil, owner, false,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structFields validates the given field names, when they're nil
+// names are looked up in the struct fields mapping or the default
+// V0..Vn names are returned.
+func (ctx *context) structFields(
+	iface *token.Interface, typ *token.Type, fields []string,
+) ([]string, error) {
+	if fields == nil {
+		fields = ctx.fieldNames[typ.Signature]
+	}
+	if fields == nil {
+		fields = make([]string, len(typ.Fields))
+		for i := range fields {
+			fields[i] = structFieldName(i)
+		}
+		return fields, nil
+	}
+	if len(fields) != len(typ.Fields) {
+		return nil, fmt.Errorf("%s: %d field names given for %q struct, want %d",
+			iface.Name, len(fields), typ.Signature, len(typ.Fields))
+	}
+	names := make([]string, len(fields))
+	for i := range fields {
+		if ctx.idiomatic {
+			names[i] = ctx.idiomaticName(fields[i], true)
+		} else {
+			names[i] = strings.Title(fields[i])
+		}
+		if !identRegexp.MatchString(names[i]) || isKeyword(names[i]) {
+			return nil, fmt.Errorf("%s: field name %q of %q struct is not a valid identifier",
+				iface.Name, fields[i], typ.Signature)
+		}
+		for j := 0; j < i; j++ {
+			if names[j] == names[i] {
+				return nil, fmt.Errorf("%s: duplicate field name %q of %q struct",
+					iface.Name, names[i], typ.Signature)
+			}
+		}
+	}
+	return names, nil
+}
+
+func structFieldName(i int) string {
+	return "V" + strconv.Itoa(i)
+}
+
+func (ctx *context) tplIfaceStructs(iface *token.Interface) []*structType {
+	var list []*structType
+	for _, st := range ctx.structList {
+		if st.owner == iface {
+			list = append(list, st)
+		}
+	}
+	return list
+}
+
+func (ctx *context) tplStructFields(st *structType) string {
+	var buf strings.Builder
+	for i, field := range st.Type.Fields {
+		buf.WriteString(st.Fields[i])
+		buf.WriteByte(' ')
+		buf.WriteString(ctx.goType(field))
+		buf.WriteByte(';')
+	}
+	return buf.String()
+}
@@ -0,0 +1,262 @@
+package printer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/amenzhinsky/dbus-codegen-go/token"
+)
+
+var basicTypes = map[token.Kind]string{
+	token.KindByte:       "byte",
+	token.KindBoolean:    "bool",
+	token.KindInt16:      "int16",
+	token.KindUint16:     "uint16",
+	token.KindInt32:      "int32",
+	token.KindUint32:     "uint32",
+	token.KindInt64:      "int64",
+	token.KindUint64:     "uint64",
+	token.KindDouble:     "float64",
+	token.KindUnixFD:     "dbus.UnixFD",
+	token.KindString:     "string",
+	token.KindObjectPath: "dbus.ObjectPath",
+	token.KindSignature:  "dbus.Signature",
+	token.KindVariant:    "dbus.Variant",
+}
+
+// goType renders the given D-Bus type as a Go type,
+// structs are rendered anonymous unless they're named.
+func (ctx *context) goType(t *token.Type) string {
+	switch t.Kind {
+	case token.KindArray:
+		return "[]" + ctx.goType(t.Elem)
+	case token.KindDict:
+		return "map[" + ctx.goType(t.Key) + "]" + ctx.goType(t.Elem)
+	case token.KindStruct:
+		if st, ok := ctx.structTypes[t]; ok {
+			return st.Name
+		}
+		fields := make([]string, len(t.Fields))
+		for i := range t.Fields {
+			fields[i] = "V" + strconv.Itoa(i) + " " + ctx.goType(t.Fields[i])
+		}
+		return "struct {" + strings.Join(fields, ";") + "}"
+	default:
+		if s, ok := basicTypes[t.Kind]; ok {
+			return s
+		}
+		panic("unsupported type kind: " + t.Kind.String())
+	}
+}
+
+// annotationType gives a Go type to the annotated property, suffixed with
+// In<N> or Out<N> it applies to an argument of the annotated method or
+// signal, the value is the type, decode and encode funcs comma-separated,
+// e.g. "time.Time,usecToTime,timeToUsec", see TypeMapping.
+const annotationType = "org.golang.Type"
+
+// typeMapping is a TypeMapping with names qualified by package names.
+type typeMapping struct {
+	typ     string
+	decode  string
+	encode  string
+	imports []string
+	idents  []string // package names and unqualified funcs
+}
+
+// resolveTypes finds type mappings of all arguments and properties.
+func (ctx *context) resolveTypes() error {
+	ctx.argTypes = map[*token.Arg]*typeMapping{}
+	ctx.typeImports = map[string]string{}
+	for _, iface := range ctx.Interfaces {
+		for _, method := range iface.Methods {
+			key := iface.Name + "." + method.Name
+			for i, arg := range method.In {
+				suffix := "In" + strconv.Itoa(i)
+				if err := ctx.mapArg(argKey(key, arg, suffix), arg, method.Annotations, suffix); err != nil {
+					return err
+				}
+			}
+			for i, arg := range method.Out {
+				suffix := "Out" + strconv.Itoa(i)
+				if err := ctx.mapArg(argKey(key, arg, suffix), arg, method.Annotations, suffix); err != nil {
+					return err
+				}
+			}
+		}
+		for _, prop := range iface.Properties {
+			if err := ctx.mapArg(iface.Name+"."+prop.Name, prop.Arg, prop.Annotations, ""); err != nil {
+				return err
+			}
+		}
+		for _, signal := range iface.Signals {
+			key := iface.Name + "." + signal.Name
+			for i, arg := range signal.Args {
+				suffix := signalArgSuffix(signal, i)
+				if err := ctx.mapArg(argKey(key, arg, suffix), arg, signal.Annotations, suffix); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mapArg looks up the type mapping of the argument identified by key,
+// nil mappings given for keys disable mappings by signatures.
+func (ctx *context) mapArg(key string, arg *token.Arg, annotations []*token.Annotation, suffix string) error {
+	m, ok := ctx.types[key]
+	if !ok {
+		var v string
+		if v, ok = findAnnotation(annotations, annotationType, suffix); ok {
+			parts := strings.Split(v, ",")
+			if len(parts) != 3 {
+				return fmt.Errorf("%s: type %q is not in Type,Decode,Encode form", key, v)
+			}
+			m = &TypeMapping{
+				Type:   strings.TrimSpace(parts[0]),
+				Decode: strings.TrimSpace(parts[1]),
+				Encode: strings.TrimSpace(parts[2]),
+			}
+		}
+	}
+	if !ok {
+		m = ctx.types[arg.Type.Signature]
+	}
+	if m == nil {
+		return nil
+	}
+	if m.Decode == "" || m.Encode == "" {
+		return fmt.Errorf("%s: type %q has no decode or encode func", key, m.Type)
+	}
+	tm := &typeMapping{}
+	var err error
+	if tm.typ, err = ctx.qualifyType(tm, m.Type); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if tm.decode, err = ctx.qualifyName(tm, m.Decode); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if tm.encode, err = ctx.qualifyName(tm, m.Encode); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	ctx.argTypes[arg] = tm
+	return nil
+}
+
+// qualifyType is qualifyName for types that may be pointers or slices.
+func (ctx *context) qualifyType(tm *typeMapping, typ string) (string, error) {
+	name := typ
+	for strings.HasPrefix(name, "*") || strings.HasPrefix(name, "[]") {
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "*"), "[]")
+	}
+	qualified, err := ctx.qualifyName(tm, name)
+	if err != nil {
+		return "", fmt.Errorf("type %q is not valid", typ)
+	}
+	return typ[:len(typ)-len(name)] + qualified, nil
+}
+
+// qualifyName replaces the import path of a qualified name with its
+// package name adding the import to tm, e.g. github.com/google/uuid.Parse
+// is uuid.Parse, the path is separated by the first dot after the last slash.
+// Names without a dot refer to the generated package.
+func (ctx *context) qualifyName(tm *typeMapping, name string) (string, error) {
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot == -1 {
+		if !identRegexp.MatchString(name) || isKeyword(name) {
+			return "", fmt.Errorf("name %q is not valid", name)
+		}
+		tm.idents = append(tm.idents, name)
+		return name, nil
+	}
+	path, sel := name[:slash+1+dot], name[slash+1+dot+1:]
+	for _, s := range strings.Split(sel, ".") {
+		if !identRegexp.MatchString(s) || isKeyword(s) {
+			return "", fmt.Errorf("name %q is not valid", name)
+		}
+	}
+	pkg := packageName(path)
+	if !identRegexp.MatchString(pkg) || isKeyword(pkg) {
+		return "", fmt.Errorf("package name of %q cannot be guessed", path)
+	}
+	if prev, ok := ctx.typeImports[pkg]; ok && prev != path {
+		return "", fmt.Errorf("package %q conflicts with %q", path, prev)
+	}
+	ctx.typeImports[pkg] = path
+	tm.imports = append(tm.imports, path)
+	tm.idents = append(tm.idents, pkg)
+	return pkg + "." + sel, nil
+}
+
+// packageName returns the last element of the import path
+// skipping major version suffixes, e.g. example.com/uuid/v2 is uuid.
+func packageName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = elems[len(elems)-2]
+	}
+	return name
+}
+
+// importMapping adds imports used by the argument's type mapping if any.
+func (ctx *context) importMapping(arg *token.Arg) *typeMapping {
+	m := ctx.argTypes[arg]
+	if m != nil {
+		for _, path := range m.imports {
+			ctx.addImport(path)
+		}
+	}
+	return m
+}
+
+func (ctx *context) tplArgType(arg *token.Arg) string {
+	if m := ctx.importMapping(arg); m != nil {
+		return m.typ
+	}
+	return ctx.goType(arg.Type)
+}
+
+// tplArgRawType returns the type of the argument's D-Bus values.
+func (ctx *context) tplArgRawType(arg *token.Arg) string {
+	return ctx.goType(arg.Type)
+}
+
+func (ctx *context) tplArgMapped(arg *token.Arg) bool {
+	return ctx.argTypes[arg] != nil
+}
+
+func (ctx *context) tplArgsMapped(args []*token.Arg) bool {
+	for _, arg := range args {
+		if ctx.tplArgMapped(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ctx *context) tplMethodMapped(method *token.Method) bool {
+	return ctx.tplArgsMapped(method.In) || ctx.tplArgsMapped(method.Out)
+}
+
+// tplArgRawName returns the name of a variable holding
+// the D-Bus value of a mapped method argument or property.
+func (ctx *context) tplArgRawName(arg *token.Arg) string {
+	return ctx.rawNames[arg]
+}
+
+// tplDecodeArg returns the argument's decode func, mapped arguments only.
+func (ctx *context) tplDecodeArg(arg *token.Arg) string {
+	return ctx.importMapping(arg).decode
+}
+
+// tplEncodeArg converts the argument's value v to its D-Bus value.
+func (ctx *context) tplEncodeArg(arg *token.Arg, v string) string {
+	if m := ctx.importMapping(arg); m != nil {
+		return m.encode + "(" + v + ")"
+	}
+	return v
+}
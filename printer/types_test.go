@@ -0,0 +1,146 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/amenzhinsky/dbus-codegen-go/parser"
+)
+
+func TestTypeMappings(t *testing.T) {
+	t.Parallel()
+
+	ifaces, err := parser.Parse([]byte(`<node>
+	<interface name="org.example.Clock">
+		<method name="Shift">
+			<arg name="at" type="t" direction="in"/>
+			<arg name="by" type="x" direction="in"/>
+			<arg name="rawAt" type="t" direction="out"/>
+			<arg name="id" type="s" direction="out"/>
+			<annotation name="org.golang.Type.In1" value="time.Duration, durationFromUsec, durationToUsec"/>
+		</method>
+		<signal name="Ticked">
+			<arg name="at" type="t"/>
+		</signal>
+		<property name="Boot" type="t" access="read"/>
+		<property name="Origin" type="(ii)" access="read"/>
+	</interface>
+</node>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = Print(&buf, ifaces, WithTypes(map[string]*TypeMapping{
+		"t":                          {Type: "time.Time", Decode: "usecToTime", Encode: "timeToUsec"},
+		"(ii)":                       {Type: "*image.Point", Decode: "pointFromStruct", Encode: "pointToStruct"},
+		"org.example.Clock.Shift.id": {Type: "github.com/google/uuid/v2.UUID", Decode: "github.com/google/uuid/v2.Parse", Encode: "formatUUID"},
+		"org.example.Clock.Boot":     nil,
+	})); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(strings.Fields(buf.String()), " ")
+	for _, s := range []string{
+		`"github.com/google/uuid/v2"`,
+		"Shift(ctx context.Context, at time.Time, by time.Duration) (rawAt time.Time, id uuid.UUID, err error)",
+		// raw variables don't conflict with arguments
+		"var rawRawRawAt uint64 var rawId string",
+		"Store(&rawRawRawAt, &rawId)",
+		"timeToUsec(at), durationToUsec(by)",
+		"if id, err = uuid.Parse(rawId); err != nil",
+		`"Shift": func(rawRawAt uint64, rawBy int64) (rawRawRawAt uint64, rawId string, err *dbus.Error)`,
+		"rawId = formatUUID(id)",
+		"At time.Time",
+		"d0, err := usecToTime(v0)",
+		"GetBoot(ctx context.Context) (boot uint64, err error)",
+		"GetOrigin(ctx context.Context) (origin *image.Point, err error)",
+		"var rawOrigin struct { V0 int32 V1 int32 }",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output doesn't contain %q", s)
+		}
+	}
+	// mapped structs are not generated
+	if strings.Contains(out, "Org_Example_Clock_OriginProperty") {
+		t.Error("struct type of a mapped property is generated")
+	}
+}
+
+func TestTypeMappingsError(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		xml   string
+		types map[string]*TypeMapping
+		error string
+	}{
+		"annotation": {
+			xml: `<node>
+	<interface name="org.example.Foo">
+		<property name="Boot" type="t" access="read">
+			<annotation name="org.golang.Type" value="time.Time"/>
+		</property>
+	</interface>
+</node>`,
+			error: `org.example.Foo.Boot: type "time.Time" is not in Type,Decode,Encode form`,
+		},
+		"funcs": {
+			types: map[string]*TypeMapping{"t": {Type: "time.Time", Decode: "usecToTime"}},
+			error: `org.example.Foo.Boot: type "time.Time" has no decode or encode func`,
+		},
+		"type": {
+			types: map[string]*TypeMapping{"t": {Type: "map[string]time.Time", Decode: "a", Encode: "b"}},
+			error: `org.example.Foo.Boot: type "map[string]time.Time" is not valid`,
+		},
+		"func": {
+			types: map[string]*TypeMapping{"t": {Type: "time.Time", Decode: "func", Encode: "b"}},
+			error: `org.example.Foo.Boot: name "func" is not valid`,
+		},
+		"package": {
+			types: map[string]*TypeMapping{"t": {Type: "time.Time", Decode: "example.com/time.Parse", Encode: "b"}},
+			error: `org.example.Foo.Boot: package "example.com/time" conflicts with "time"`,
+		},
+		"package name": {
+			types: map[string]*TypeMapping{"t": {Type: "example.com/go-time.Time", Decode: "a", Encode: "b"}},
+			error: `org.example.Foo.Boot: type "example.com/go-time.Time" is not valid`,
+		},
+		"generated": {
+			types: map[string]*TypeMapping{"t": {Type: "example.com/dbus.Time", Decode: "a", Encode: "b"}},
+			error: "example.com/dbus package conflicts with generated code",
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			xml := test.xml
+			if xml == "" {
+				xml = `<node>
+	<interface name="org.example.Foo">
+		<property name="Boot" type="t" access="read"/>
+	</interface>
+</node>`
+			}
+			ifaces, err := parser.Parse([]byte(xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err = Print(&buf, ifaces, WithTypes(test.types)); err == nil || err.Error() != test.error {
+				t.Errorf("Print error = %v, want %q", err, test.error)
+			}
+		})
+	}
+}
+
+func TestPackageName(t *testing.T) {
+	for path, want := range map[string]string{
+		"time":                      "time",
+		"github.com/google/uuid":    "uuid",
+		"github.com/gofrs/uuid/v5":  "uuid",
+		"example.com/vendor/vector": "vector",
+	} {
+		if have := packageName(path); have != want {
+			t.Errorf("packageName(%q) = %q, want %q", path, have, want)
+		}
+	}
+}
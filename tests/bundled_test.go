@@ -0,0 +1,168 @@
+package integration_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestBundled exports servers generated from all testdata files and
+// exercises their clients with testdata/test_bundled.go, servers are
+// implemented by code derived from the generated server interfaces.
+func TestBundled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	src, err := os.ReadFile("testdata/test_bundled.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, ok := privateBus(t)
+	for _, f := range xmlFiles {
+		f := f
+		t.Run(f, func(t *testing.T) {
+			t.Parallel()
+			input, err := os.ReadFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gen, err := generate(f)
+			if err != nil {
+				t.Fatalf("generate(%s) error: %s", f, err)
+			}
+			impl, err := bundledServers(gen, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = compile(map[string][]byte{
+				"gen.go":  gen,
+				"impl.go": impl,
+				"main.go": src,
+			}, ok, env...); err != nil {
+				t.Fatalf("compile(%s) error: %s", f, err)
+			}
+		})
+	}
+}
+
+// standard interfaces are served by the generated runtime itself.
+var standardIfaces = map[string]bool{
+	"org.freedesktop.DBus.Peer":           true,
+	"org.freedesktop.DBus.Introspectable": true,
+	"org.freedesktop.DBus.Properties":     true,
+}
+
+var exportDoc = regexp.MustCompile(`implements (\S+) on the bus`)
+
+// bundledServers returns code registering servers of all non-standard
+// interfaces found in the generated code along with their signals,
+// server methods return errReached error without doing anything.
+func bundledServers(gen, input []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "gen.go", gen, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	ifaces := map[string]*ast.InterfaceType{}
+	var signals []string
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.TypeSpec)
+			switch typ := spec.Type.(type) {
+			case *ast.InterfaceType:
+				ifaces[spec.Name.Name] = typ
+			case *ast.StructType:
+				if isSignal(typ) {
+					signals = append(signals, spec.Name.Name)
+				}
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("package main\n\nimport \"github.com/godbus/dbus/v5\"\n\n")
+	fmt.Fprintf(&b, "const inputXML = %s\n\n", strconv.Quote(string(input)))
+
+	var impls bytes.Buffer
+	b.WriteString("var servers = []bundledServer{\n")
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Export") || fn.Doc == nil {
+			continue
+		}
+		m := exportDoc.FindStringSubmatch(fn.Doc.Text())
+		if m == nil || standardIfaces[m[1]] {
+			continue
+		}
+		params := fn.Type.Params.List
+		server, ok := params[len(params)-1].Type.(*ast.Ident)
+		if !ok || ifaces[server.Name] == nil {
+			return nil, fmt.Errorf("%s server type is not found", fn.Name.Name)
+		}
+		typ := strings.TrimPrefix(fn.Name.Name, "Export")
+		impl := "reached" + typ
+		fmt.Fprintf(&impls, "type %s struct{}\n\n", impl)
+
+		var members []string
+		for _, method := range ifaces[server.Name].Methods.List {
+			ft := method.Type.(*ast.FuncType)
+			results := ft.Results.List
+			if len(results[len(results)-1].Names) == 0 {
+				return nil, fmt.Errorf("%s.%s results are not named", server.Name, method.Names[0].Name)
+			}
+			var sig bytes.Buffer
+			if err = printer.Fprint(&sig, fset, ft); err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&impls, "func (*%s) %s%s {\n\t%s = errReached\n\treturn\n}\n\n",
+				impl, method.Names[0].Name, strings.TrimPrefix(sig.String(), "func"),
+				results[len(results)-1].Names[0].Name,
+			)
+			members = append(members, strconv.Quote(method.Names[0].Name))
+		}
+
+		fmt.Fprintf(&b, "\t{\n\t\tname: %q,\n", m[1])
+		fmt.Fprintf(&b, "\t\texport: func(conn *dbus.Conn, path dbus.ObjectPath) error {\n\t\t\treturn %s(conn, path, &%s{})\n\t\t},\n", fn.Name.Name, impl)
+		fmt.Fprintf(&b, "\t\tclient: func(object dbus.BusObject) interface{} {\n\t\t\treturn New%s(object)\n\t\t},\n", typ)
+		fmt.Fprintf(&b, "\t\tmembers: []string{%s},\n\t},\n", strings.Join(members, ", "))
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("var signals = []interface{}{\n")
+	for _, name := range signals {
+		fmt.Fprintf(&b, "\t&%s{},\n", name)
+	}
+	b.WriteString("}\n\n")
+	if len(signals) != 0 {
+		b.WriteString("func emitSignal(conn *dbus.Conn, s interface{}) error {\n\treturn Emit(conn, s.(Signal))\n}\n\n")
+		b.WriteString("func lookupSignal(sig *dbus.Signal) (interface{}, error) {\n\treturn LookupSignal(sig)\n}\n\n")
+	} else {
+		b.WriteString("func emitSignal(conn *dbus.Conn, s interface{}) error {\n\tpanic(\"no signals\")\n}\n\n")
+		b.WriteString("func lookupSignal(sig *dbus.Signal) (interface{}, error) {\n\tpanic(\"no signals\")\n}\n\n")
+	}
+	b.Write(impls.Bytes())
+	return b.Bytes(), nil
+}
+
+// isSignal reports whether the struct is a generated signal type.
+func isSignal(typ *ast.StructType) bool {
+	var names []string
+	for _, field := range typ.Fields.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return strings.Join(names, ",") == "sender,Path,Body"
+}
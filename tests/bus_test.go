@@ -0,0 +1,79 @@
+package integration_test
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// busConfig is a permissive configuration for a private message bus
+// listening on a unix socket in the given directory.
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+"http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+	<type>session</type>
+	<listen>unix:dir=%s</listen>
+	<auth>EXTERNAL</auth>
+	<policy context="default">
+		<allow send_destination="*" eavesdrop="true"/>
+		<allow eavesdrop="true"/>
+		<allow own="*"/>
+	</policy>
+</busconfig>
+`
+
+// privateBus starts a private message bus returning environment
+// variables pointing to it, ok is false when dbus-daemon is not installed
+// so scenarios can only be compiled.
+func privateBus(t *testing.T) (env []string, ok bool) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Log("dbus-daemon is not installed, scenarios are only compiled")
+		return nil, false
+	}
+	return busEnv(startBus(t, daemon)), true
+}
+
+// startBus launches a private dbus-daemon that lives until the test
+// and all its subtests complete and returns its address.
+func startBus(t *testing.T, daemon string) string {
+	t.Helper()
+	temp := t.TempDir()
+	conf := filepath.Join(temp, "bus.conf")
+	if err := os.WriteFile(conf, []byte(fmt.Sprintf(busConfig, temp)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--nofork", "--nopidfile", "--print-address", "--config-file="+conf)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("dbus-daemon address read error: %s", err)
+	}
+	return strings.TrimSpace(addr)
+}
+
+// busEnv returns environment variables that make both
+// the session and system bus connections use the named address.
+func busEnv(addr string) []string {
+	return []string{
+		"DBUS_SESSION_BUS_ADDRESS=" + addr,
+		"DBUS_SYSTEM_BUS_ADDRESS=" + addr,
+	}
+}
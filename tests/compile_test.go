@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
@@ -27,6 +28,9 @@ var xmlFiles = []string{
 	"testdata/org.freedesktop.UDisks2.xml",
 	"testdata/org.freedesktop.Upower.xml",
 	"testdata/org.gnome.DisplayManager.xml",
+
+	// hand-written
+	"testdata/org.example.Names.xml",
 }
 
 func TestReproducibility(t *testing.T) {
@@ -69,38 +73,72 @@ func main() {}`)
 			t.Run("camelize", func(t *testing.T) {
 				checkCompile(t, src, "-camelize", f)
 			})
+			t.Run("idiomatic", func(t *testing.T) {
+				checkCompile(t, src, "-idiomatic", f)
+			})
 			t.Run("server-only", func(t *testing.T) {
 				checkCompile(t, src, "-server-only", f)
 			})
 			t.Run("client-only", func(t *testing.T) {
 				checkCompile(t, src, "-client-only", f)
 			})
+			t.Run("fakes", func(t *testing.T) {
+				checkCompile(t, src, "-fakes", f)
+			})
+			t.Run("server-context", func(t *testing.T) {
+				checkCompile(t, src, "-server-context", f)
+			})
+			t.Run("output-dir", func(t *testing.T) {
+				checkCompileDir(t, src, f)
+			})
 		})
 	}
+
+	// names conflicting with generated code once prefixes are stripped
+	t.Run("prefix", func(t *testing.T) {
+		checkCompile(t, src, "-prefix=org.example", "-fakes", "testdata/org.example.Names.xml")
+	})
 }
 
 func TestScenario(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode")
 	}
+	env, ok := privateBus(t)
 	for _, tc := range [][]string{
 		{"testdata/test_signal.go", "testdata/org.freedesktop.DBus.xml"},
 		{"testdata/test_single_method.go", "testdata/org.freedesktop.DBus.xml"},
 		{"testdata/test_properties.go", "testdata/org.freedesktop.DBus.xml"},
 		{"testdata/test_server_export.go", "testdata/org.freedesktop.DBus.xml"},
 		{"testdata/test_server_emit.go", "testdata/org.freedesktop.DBus.xml"},
+		{"testdata/test_end_to_end.go", "testdata/org.example.Test.xml"},
+		{"testdata/test_server_context.go", "-server-context", "testdata/org.example.Test.xml"},
+		{"testdata/test_fakes.go", "-fakes", "testdata/org.example.Test.xml"},
+		{"testdata/test_types.go",
+			"-type=org.example.Test.Echo.in=net.IP,parseIP,formatIP",
+			"-type=org.example.Test.Echo.out=net.IP,parseIP,formatIP",
+			"-type=x=time.Duration,durationFromUsec,durationToUsec",
+			"-type=(iu)=image.Point,pointFromStruct,pointToStruct",
+			"-type=org.example.Test.Level=level,levelFromInt32,levelToInt32",
+			"-type=org.example.Test.Tick.n=count,countFromUint32,countToUint32",
+			"testdata/org.example.Test.xml"},
 	} {
-		goFile, xmlFile := tc[0], tc[1]
+		goFile, args := tc[0], tc[1:]
 		t.Run(goFile, func(t *testing.T) {
 			b, err := os.ReadFile(goFile)
 			if err != nil {
 				t.Fatal(err)
 			}
-			checkCompile(t, b, xmlFile)
+			if ok {
+				checkRun(t, b, env, args...)
+			} else {
+				checkCompile(t, b, args...)
+			}
 		})
 	}
 }
 
+// checkCompile generates code with the given args and builds it along with src.
 func checkCompile(t *testing.T, src []byte, args ...string) {
 	t.Helper()
 	t.Parallel()
@@ -108,35 +146,82 @@ func checkCompile(t *testing.T, src []byte, args ...string) {
 	if err != nil {
 		t.Fatalf("generate(%v) error: %s", args, err)
 	}
-	if err := compile(b, src); err != nil {
+	if err := compile(map[string][]byte{"gen.go": b, "main.go": src}, false); err != nil {
+		t.Fatalf("compile(%q, %v) error: %s", src, args, err)
+	}
+}
+
+// checkRun generates code with the given args and runs it
+// along with src having env added to the environment.
+func checkRun(t *testing.T, src []byte, env []string, args ...string) {
+	t.Helper()
+	t.Parallel()
+	b, err := generate(args...)
+	if err != nil {
+		t.Fatalf("generate(%v) error: %s", args, err)
+	}
+	if err := compile(map[string][]byte{"gen.go": b, "main.go": src}, true, env...); err != nil {
 		t.Fatalf("compile(%q, %v) error: %s", src, args, err)
 	}
 }
 
+func checkCompileDir(t *testing.T, src []byte, args ...string) {
+	t.Helper()
+	t.Parallel()
+	temp, err := os.MkdirTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(temp)
+
+	args = append([]string{"-output-dir=" + temp}, args...)
+	if _, err = generate(args...); err != nil {
+		t.Fatalf("generate(%v) error: %s", args, err)
+	}
+	if err = os.WriteFile(temp+"/main.go", src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(temp + "/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(
+		"go", append([]string{"run"}, files...)...,
+	).CombinedOutput(); err != nil {
+		t.Fatalf("compile(%v) error: %s", args, out)
+	}
+}
+
 func generate(args ...string) ([]byte, error) {
 	cmd := exec.Command("go",
-		append([]string{"run", "../main.go", "-package=main"}, args...)...,
+		append([]string{"run", "..", "-package=main"}, args...)...,
 	)
 	cmd.Stderr = os.Stderr
 	return cmd.Output()
 }
 
-func compile(gen, src []byte) error {
+// compile builds the named files and runs the program
+// when run is true having env added to the environment.
+func compile(files map[string][]byte, run bool, env ...string) error {
 	temp, err := os.MkdirTemp("", "")
 	if err != nil {
 		return err
 	}
 	//defer os.RemoveAll(temp)
 
-	if err = os.WriteFile(temp+"/gen.go", gen, 0644); err != nil {
-		return err
+	args := []string{"build", "-o", temp + "/main"}
+	if run {
+		args = []string{"run"}
 	}
-	if err = os.WriteFile(temp+"/main.go", src, 0644); err != nil {
-		return err
+	for name, b := range files {
+		if err = os.WriteFile(temp+"/"+name, b, 0644); err != nil {
+			return err
+		}
+		args = append(args, temp+"/"+name)
 	}
-	if out, err := exec.Command(
-		"go", "run", temp+"/main.go", temp+"/gen.go",
-	).CombinedOutput(); err != nil {
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), env...)
+	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("compile error: %s", out)
 	}
 	return nil
@@ -0,0 +1,104 @@
+package integration_test
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExamples checks that code generated for examples is up to date
+// by running their go:generate directives with a temporary output.
+func TestExamples(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	files, err := filepath.Glob("../_examples/*/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	more, err := filepath.Glob("../_examples/*/*/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for _, file := range append(files, more...) {
+		for _, args := range generateDirectives(t, file) {
+			file, args := file, args
+			n++
+			t.Run(file, func(t *testing.T) {
+				t.Parallel()
+				checkExample(t, filepath.Dir(file), args)
+			})
+		}
+	}
+	if n == 0 {
+		t.Fatal("no go:generate directives found")
+	}
+}
+
+// generateDirectives returns arguments of `go run` go:generate directives in the file.
+func generateDirectives(t *testing.T, file string) [][]string {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var directives [][]string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if !strings.HasPrefix(s.Text(), "//go:generate ") {
+			continue
+		}
+		args := strings.Fields(strings.TrimPrefix(s.Text(), "//go:generate "))
+		if len(args) < 3 || args[0] != "go" || args[1] != "run" {
+			t.Fatalf("%s: %q is not a go run directive", file, s.Text())
+		}
+		directives = append(directives, args[2:])
+	}
+	if err = s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return directives
+}
+
+// checkExample runs the generator in dir with the given args
+// and compares its output to the file named by -output flag.
+func checkExample(t *testing.T, dir string, args []string) {
+	t.Helper()
+	var output, temp string
+	genArgs := make([]string, len(args))
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-output=") {
+			output = strings.TrimPrefix(arg, "-output=")
+			temp = filepath.Join(t.TempDir(), filepath.Base(output))
+			arg = "-output=" + temp
+		}
+		genArgs[i] = arg
+	}
+	if output == "" {
+		t.Fatalf("%v: -output is not set", args)
+	}
+	want, err := os.ReadFile(filepath.Join(dir, output))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", append([]string{"run"}, genArgs...)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generate(%v) error: %s", args, out)
+	}
+	have, err := os.ReadFile(temp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("%s is out of date, run go generate in %s", output, dir)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/amenzhinsky/dbus-codegen-go/parser"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+// bundledPath is the path all servers are exported on.
+const bundledPath = dbus.ObjectPath("/org/example/Bundled")
+
+// errReached is returned by all methods and property accessors
+// of exported servers to prove that calls reach them.
+var errReached = dbus.NewError("org.example.Error.Reached", nil)
+
+// bundledServer is a server of an interface from inputXML,
+// members are names of methods it shares with its client.
+type bundledServer struct {
+	name    string
+	export  func(conn *dbus.Conn, path dbus.ObjectPath) error
+	client  func(object dbus.BusObject) interface{}
+	members []string
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	server, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	client, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, s := range servers {
+		if err = s.export(server, bundledPath); err != nil {
+			return fmt.Errorf("export %s: %w", s.name, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	obj := client.Object(server.Names()[0], bundledPath)
+	for _, fn := range []func(context.Context, *dbus.Conn, *dbus.Conn, dbus.BusObject) error{
+		testIntrospection,
+		testMembers,
+		testSignals,
+	} {
+		if err = fn(ctx, server, client, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testIntrospection checks that exported interfaces are described the same way as the input.
+func testIntrospection(ctx context.Context, server, client *dbus.Conn, obj dbus.BusObject) error {
+	input, err := parser.Parse([]byte(inputXML))
+	if err != nil {
+		return err
+	}
+	node, err := introspect.Call(obj)
+	if err != nil {
+		return err
+	}
+	served, err := parser.ParseNode(node)
+	if err != nil {
+		return err
+	}
+	for _, s := range servers {
+		var want, have interface{}
+		for _, iface := range input {
+			if iface.Name == s.name {
+				want = iface
+			}
+		}
+		for _, iface := range served {
+			if iface.Name == s.name {
+				have = iface
+			}
+		}
+		if have == nil {
+			return fmt.Errorf("%s is not introspectable", s.name)
+		}
+		if !reflect.DeepEqual(have, want) {
+			return fmt.Errorf("introspected %s doesn't match the input", s.name)
+		}
+	}
+	return nil
+}
+
+// testMembers calls methods and property accessors with zero values.
+func testMembers(ctx context.Context, server, client *dbus.Conn, obj dbus.BusObject) error {
+	for _, s := range servers {
+		proxy := reflect.ValueOf(s.client(obj))
+		for _, name := range s.members {
+			method := proxy.MethodByName(name)
+			if !method.IsValid() {
+				return fmt.Errorf("%s client has no %s method", s.name, name)
+			}
+			args := []reflect.Value{reflect.ValueOf(ctx)}
+			for i := 1; i < method.Type().NumIn(); i++ {
+				args = append(args, zeroValue(method.Type().In(i)))
+			}
+			out := method.Call(args)
+			err, _ := out[len(out)-1].Interface().(error)
+			var dbusErr dbus.Error
+			if !errors.As(err, &dbusErr) || dbusErr.Name != errReached.Name {
+				return fmt.Errorf("%s.%s error = %v, want %s", s.name, name, err, errReached.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// testSignals emits all signals with zero values and decodes them back.
+func testSignals(ctx context.Context, server, client *dbus.Conn, obj dbus.BusObject) error {
+	if len(signals) == 0 {
+		return nil
+	}
+	if err := client.AddMatchSignal(dbus.WithMatchObjectPath(bundledPath)); err != nil {
+		return err
+	}
+	ch := make(chan *dbus.Signal, len(signals)+10)
+	client.Signal(ch)
+	defer client.RemoveSignal(ch)
+
+	for _, s := range signals {
+		v := reflect.ValueOf(s).Elem()
+		v.FieldByName("Path").Set(reflect.ValueOf(bundledPath))
+		body := v.FieldByName("Body")
+		body.Set(reflect.New(body.Type().Elem()))
+		fill(body.Elem())
+		if err := emitSignal(server, s); err != nil {
+			return fmt.Errorf("emit %T: %w", s, err)
+		}
+	}
+	for _, s := range signals {
+		var raw *dbus.Signal
+		for raw == nil || raw.Path != bundledPath {
+			select {
+			case raw = <-ch:
+			case <-ctx.Done():
+				return fmt.Errorf("%T is not received: %w", s, ctx.Err())
+			}
+		}
+		received, err := lookupSignal(raw)
+		if err != nil {
+			return fmt.Errorf("lookup %s: %w", raw.Name, err)
+		}
+		if reflect.TypeOf(received) != reflect.TypeOf(s) {
+			return fmt.Errorf("received %T, want %T", received, s)
+		}
+		// file descriptors are duplicated by receivers
+		clearFDs(reflect.ValueOf(bodyOf(received)).Elem())
+		if have, want := fmt.Sprintf("%+v", bodyOf(received)), fmt.Sprintf("%+v", bodyOf(s)); have != want {
+			return fmt.Errorf("%T body = %s, want %s", s, have, want)
+		}
+	}
+	return nil
+}
+
+func bodyOf(s interface{}) interface{} {
+	return reflect.ValueOf(s).Elem().FieldByName("Body").Interface()
+}
+
+// clearFDs zeroes file descriptors of the struct.
+func clearFDs(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Type() == unixFDType {
+			v.Field(i).SetInt(0)
+		}
+	}
+}
+
+// zeroValue returns a zero value of the type that can be sent over the bus.
+func zeroValue(typ reflect.Type) reflect.Value {
+	v := reflect.New(typ).Elem()
+	fill(v)
+	return v
+}
+
+var (
+	variantType    = reflect.TypeOf(dbus.Variant{})
+	objectPathType = reflect.TypeOf(dbus.ObjectPath(""))
+	unixFDType     = reflect.TypeOf(dbus.UnixFD(0))
+)
+
+// fill sets values that cannot be sent zeroed, variants and object paths.
+func fill(v reflect.Value) {
+	switch {
+	case v.Type() == variantType:
+		v.Set(reflect.ValueOf(dbus.MakeVariant("")))
+	case v.Type() == objectPathType:
+		v.SetString("/")
+	case v.Kind() == reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fill(v.Field(i))
+			}
+		}
+	}
+}
@@ -0,0 +1,652 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amenzhinsky/dbus-codegen-go/parser"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+const (
+	serviceName = "org.example.Test"
+	root        = dbus.ObjectPath("/org/example")
+	path1       = dbus.ObjectPath("/org/example/Test1")
+	path2       = dbus.ObjectPath("/org/example/Test2")
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	server, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	client, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	reply, err := server.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("name %s is already taken", serviceName)
+	}
+	if err = ServeObjectManager(server, root); err != nil {
+		return err
+	}
+	if err = ExportOrg_Example_Test(server, path1, &testServer{level: 1}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	o := NewOrg_Example_Test(client.Object(serviceName, path1))
+	for _, fn := range []func(context.Context, *dbus.Conn, *dbus.Conn, *Org_Example_Test) error{
+		testMethods,
+		testErrors,
+		testProperties,
+		testPropertyChanges,
+		testSignals,
+		testIntrospection,
+		testObjectManager,
+		testExports,
+	} {
+		if err = fn(ctx, server, client, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type testServer struct {
+	UnimplementedOrg_Example_Test
+
+	mu    sync.Mutex
+	level int32
+	token string
+}
+
+func (s *testServer) Echo(in string) (string, *dbus.Error) {
+	return in, nil
+}
+
+func (s *testServer) Sum(values []int32) (sum int64, count uint32, err *dbus.Error) {
+	for _, v := range values {
+		sum += int64(v)
+	}
+	return sum, uint32(len(values)), nil
+}
+
+func (s *testServer) Split(text, sep string) ([]string, *dbus.Error) {
+	return strings.Split(text, sep), nil
+}
+
+func (s *testServer) Lookup(entries map[string]Entry, key string) (Entry, *dbus.Error) {
+	entry, ok := entries[key]
+	if !ok {
+		return Entry{}, dbus.NewError("org.example.Error.NotFound", []interface{}{key})
+	}
+	return entry, nil
+}
+
+func (s *testServer) Fail(name, message string) *dbus.Error {
+	return dbus.NewError(name, []interface{}{message})
+}
+
+func (s *testServer) GetName() (string, *dbus.Error) {
+	return "test", nil
+}
+
+func (s *testServer) GetLevel() (int32, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.level, nil
+}
+
+func (s *testServer) SetLevel(level int32) *dbus.Error {
+	if level < 0 {
+		return dbus.NewError("org.example.Error.InvalidLevel", []interface{}{"Negative level"})
+	}
+	if level > 100 {
+		level = 100
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.level = level
+	return nil
+}
+
+func (s *testServer) SetToken(token string) *dbus.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+	return nil
+}
+
+func (s *testServer) SetSecret(secret string) *dbus.Error {
+	return nil
+}
+
+func (s *testServer) GetCurrent() (Entry, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Entry{Level: s.level, Flags: uint32(len(s.token))}, nil
+}
+
+func testMethods(ctx context.Context, server, client *dbus.Conn, o *Org_Example_Test) error {
+	out, err := o.Echo(ctx, "hello")
+	if err != nil {
+		return err
+	}
+	if out != "hello" {
+		return fmt.Errorf("Echo = %q, want %q", out, "hello")
+	}
+
+	sum, count, err := o.Sum(ctx, []int32{1, 2, 3})
+	if err != nil {
+		return err
+	}
+	if sum != 6 || count != 3 {
+		return fmt.Errorf("Sum = %d, %d, want 6, 3", sum, count)
+	}
+
+	parts, err := o.Split(ctx, "a,b", ",")
+	if err != nil {
+		return err
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(parts, want) {
+		return fmt.Errorf("Split = %q, want %q", parts, want)
+	}
+
+	entry, err := o.Lookup(ctx, map[string]Entry{
+		"a": {Level: 1, Flags: 2},
+		"b": {Level: 3, Flags: 4},
+	}, "b")
+	if err != nil {
+		return err
+	}
+	if want := (Entry{Level: 3, Flags: 4}); entry != want {
+		return fmt.Errorf("Lookup = %v, want %v", entry, want)
+	}
+	return nil
+}
+
+func testErrors(ctx context.Context, server, client *dbus.Conn, o *Org_Example_Test) error {
+	if err := expectError(o.Fail(ctx, "org.example.Error.Failed", "oops"),
+		"org.example.Error.Failed", "oops"); err != nil {
+		return fmt.Errorf("Fail: %w", err)
+	}
+	_, err := o.Lookup(ctx, nil, "c")
+	if err = expectError(err, "org.example.Error.NotFound", "c"); err != nil {
+		return fmt.Errorf("Lookup: %w", err)
+	}
+	if err := expectError(o.SetLevel(ctx, -1),
+		"org.example.Error.InvalidLevel", "Negative level"); err != nil {
+		return fmt.Errorf("SetLevel: %w", err)
+	}
+
+	obj := client.Object(serviceName, path1)
+	if err := expectError(obj.CallWithContext(ctx, InterfaceOrg_Example_Test+".Missing", 0).Err,
+		"org.freedesktop.DBus.Error.UnknownMethod", ""); err != nil {
+		return fmt.Errorf("Missing: %w", err)
+	}
+	for _, tc := range []struct {
+		method string
+		args   []interface{}
+		want   string
+	}{
+		{"Get", []interface{}{"org.example.Missing", "Name"}, "org.freedesktop.DBus.Error.UnknownInterface"},
+		{"Get", []interface{}{InterfaceOrg_Example_Test, "Missing"}, "org.freedesktop.DBus.Error.UnknownProperty"},
+		{"Get", []interface{}{InterfaceOrg_Example_Test, "Token"}, "org.freedesktop.DBus.Error.AccessDenied"},
+		{"Set", []interface{}{InterfaceOrg_Example_Test, "Name", dbus.MakeVariant("x")}, "org.freedesktop.DBus.Error.PropertyReadOnly"},
+		{"Set", []interface{}{InterfaceOrg_Example_Test, "Level", dbus.MakeVariant("x")}, "org.freedesktop.DBus.Error.InvalidArgs"},
+	} {
+		err := obj.CallWithContext(ctx, "org.freedesktop.DBus.Properties."+tc.method, 0, tc.args...).Err
+		if err = expectError(err, tc.want, ""); err != nil {
+			return fmt.Errorf("%s%v: %w", tc.method, tc.args, err)
+		}
+	}
+
+	// properties of an exported object are not served below it
+	err = client.Object(serviceName, path1+"/child").CallWithContext(ctx,
+		"org.freedesktop.DBus.Properties.Get", 0, InterfaceOrg_Example_Test, "Name").Err
+	if err = expectError(err, "org.freedesktop.DBus.Error.UnknownObject", ""); err != nil {
+		return fmt.Errorf("Get on %s/child: %w", path1, err)
+	}
+	return nil
+}
+
+// expectError checks that err is a D-Bus error with the given name
+// and the message if it's not empty.
+func expectError(err error, name, message string) error {
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) {
+		return fmt.Errorf("error = %v, want %s", err, name)
+	}
+	if dbusErr.Name != name {
+		return fmt.Errorf("error name = %s, want %s", dbusErr.Name, name)
+	}
+	if message != "" && dbusErr.Error() != message {
+		return fmt.Errorf("error message = %q, want %q", dbusErr.Error(), message)
+	}
+	return nil
+}
+
+func testProperties(ctx context.Context, server, client *dbus.Conn, o *Org_Example_Test) error {
+	name, err := o.GetName(ctx)
+	if err != nil {
+		return err
+	}
+	if name != "test" {
+		return fmt.Errorf("GetName = %q, want %q", name, "test")
+	}
+	if err = o.SetLevel(ctx, 5); err != nil {
+		return err
+	}
+	level, err := o.GetLevel(ctx)
+	if err != nil {
+		return err
+	}
+	if level != 5 {
+		return fmt.Errorf("GetLevel = %d, want 5", level)
+	}
+	if err = o.SetToken(ctx, "abc"); err != nil {
+		return err
+	}
+	current, err := o.GetCurrent(ctx)
+	if err != nil {
+		return err
+	}
+	if want := (Entry{Level: 5, Flags: 3}); current != want {
+		return fmt.Errorf("GetCurrent = %v, want %v", current, want)
+	}
+
+	props, err := o.GetAllProperties(ctx)
+	if err != nil {
+		return err
+	}
+	want := &Org_Example_Test_Snapshot{
+		Name:    "test",
+		Level:   5,
+		Current: Entry{Level: 5, Flags: 3},
+	}
+	if !reflect.DeepEqual(props, want) {
+		return fmt.Errorf("GetAllProperties = %+v, want %+v", props, want)
+	}
+	return nil
+}
+
+func testPropertyChanges(ctx context.Context, server, client *dbus.Conn, o *Org_Example_Test) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changes, err := WatchOrg_Example_Test_PropertyChanges(ctx, client,
+		WithWatchSender(serviceName), WithWatchPath(path1),
+	)
+	if err != nil {
+		return err
+	}
+
+	props := &Org_Example_Test_Snapshot{}
+	if err = o.SetLevel(ctx, 7); err != nil {
+		return err
+	}
+	c, err := receiveChanges(ctx, changes)
+	if err != nil {
+		return err
+	}
+	if c.Path != path1 || c.Changed.Level == nil || *c.Changed.Level != 7 {
+		return fmt.Errorf("PropertyChanges = %+v, want Level = 7 on %s", c, path1)
+	}
+	c.Apply(props)
+	if props.Level != 7 {
+		return fmt.Errorf("Apply: Level = %d, want 7", props.Level)
+	}
+
+	// the value stored by the setter is announced
+	if err = o.SetLevel(ctx, 150); err != nil {
+		return err
+	}
+	if c, err = receiveChanges(ctx, changes); err != nil {
+		return err
+	}
+	if c.Changed.Level == nil || *c.Changed.Level != 100 {
+		return fmt.Errorf("PropertyChanges = %+v, want Level = 100", c)
+	}
+
+	if err = o.SetToken(ctx, "abcd"); err != nil {
+		return err
+	}
+	if c, err = receiveChanges(ctx, changes); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(c.Invalidated, []string{"Token"}) {
+		return fmt.Errorf("PropertyChanges.Invalidated = %v, want [Token]", c.Invalidated)
+	}
+
+	// values of write-only properties aren't disclosed
+	raw := make(chan *dbus.Signal, 10)
+	client.Signal(raw)
+	defer client.RemoveSignal(raw)
+	if err = o.SetSecret(ctx, "password"); err != nil {
+		return err
+	}
+	if c, err = receiveChanges(ctx, changes); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(c.Invalidated, []string{"Secret"}) {
+		return fmt.Errorf("PropertyChanges.Invalidated = %v, want [Secret]", c.Invalidated)
+	}
+	for sig := range raw {
+		if sig.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" {
+			continue
+		}
+		if changed, _ := sig.Body[1].(map[string]dbus.Variant); len(changed) != 0 {
+			return fmt.Errorf("PropertiesChanged changed properties = %v, want none", changed)
+		}
+		break
+	}
+
+	// unchanged values are kept
+	props.Name = "test"
+	c.Apply(props)
+	if props.Name != "test" || props.Level != 7 {
+		return fmt.Errorf("Apply: snapshot = %+v, want Name = test and Level = 7", props)
+	}
+
+	// changes of other interfaces and mistyped values are rejected
+	for _, body := range [][]interface{}{
+		{"org.example.Other", map[string]dbus.Variant{}, []string{}},
+		{InterfaceOrg_Example_Test, map[string]dbus.Variant{"Level": dbus.MakeVariant("7")}, []string{}},
+	} {
+		if _, err = ParseOrg_Example_Test_PropertyChanges(&dbus.Signal{
+			Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+			Body: body,
+		}); err == nil {
+			return fmt.Errorf("ParseOrg_Example_Test_PropertyChanges(%v) error is nil", body)
+		}
+	}
+	return nil
+}
+
+func testSignals(ctx context.Context, server, client *dbus.Conn, o *Org_Example_Test) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ticks, err := WatchOrg_Example_Test_Tick(ctx, client, WithWatchSender(serviceName))
+	if err != nil {
+		return err
+	}
+	// subscribes to signals of path1 only
+	watched, err := o.WatchTick(ctx, client)
+	if err != nil {
+		return err
+	}
+	nsCtx, nsCancel := context.WithCancel(ctx)
+	defer nsCancel()
+	below, err := WatchOrg_Example_Test_Tick(nsCtx, client, WithWatchPathNamespace(path1))
+	if err != nil {
+		return err
+	}
+
+	d := NewSignalDispatcher(client)
+	defer d.Close()
+	dispatched := make(chan *Org_Example_Test_TickSignal, 1)
+	if _, err = d.OnOrg_Example_Test_Tick(func(s *Org_Example_Test_TickSignal) {
+		dispatched <- s
+	}, WithWatchPath(path1)); err != nil {
+		return err
+	}
+
+	if err = Emit(server, &Org_Example_Test_TickSignal{
+		Path: path1 + "/other",
+		Body: &Org_Example_Test_TickSignalBody{N: 1},
+	}); err != nil {
+		return err
+	}
+	if err = Emit(server, &Org_Example_Test_TickSignal{
+		Path: path1,
+		Body: &Org_Example_Test_TickSignalBody{
+			N:    42,
+			Data: map[string]dbus.Variant{"key": dbus.MakeVariant("value")},
+		},
+	}); err != nil {
+		return err
+	}
+
+	for _, c := range []<-chan *Org_Example_Test_TickSignal{ticks, below} {
+		if s, err := receiveTick(ctx, c); err != nil {
+			return err
+		} else if s.Path != path1+"/other" || s.Body.N != 1 {
+			return fmt.Errorf("Tick on %s body = %+v, want N = 1 on %s/other", s.Path, s.Body, path1)
+		}
+	}
+	for _, c := range []<-chan *Org_Example_Test_TickSignal{ticks, watched, below, dispatched} {
+		s, err := receiveTick(ctx, c)
+		if err != nil {
+			return err
+		}
+		if s.Path != path1 || s.Sender() != server.Names()[0] {
+			return fmt.Errorf("Tick from %s on %s, want %s on %s",
+				s.Sender(), s.Path, server.Names()[0], path1)
+		}
+		if s.Body.N != 42 || s.Body.Data["key"].Value() != "value" {
+			return fmt.Errorf("Tick body = %+v, want N = 42 and key = value", s.Body)
+		}
+	}
+
+	// channels are closed when their contexts are done
+	nsCancel()
+	for err == nil {
+		_, err = receiveTick(ctx, below)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("Tick channel is not closed: %w", ctx.Err())
+	}
+	return nil
+}
+
+func testIntrospection(ctx context.Context, server, client *dbus.Conn, o *Org_Example_Test) error {
+	node, err := introspect.Call(client.Object(serviceName, path1))
+	if err != nil {
+		return err
+	}
+	want := []string{
+		"org.freedesktop.DBus.Peer",
+		"org.freedesktop.DBus.Introspectable",
+		"org.freedesktop.DBus.Properties",
+		InterfaceOrg_Example_Test,
+	}
+	var got []string
+	for _, iface := range node.Interfaces {
+		got = append(got, iface.Name)
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("introspected interfaces = %v, want %v", got, want)
+	}
+
+	// exported interfaces are described the same way as the input
+	b, err := os.ReadFile("testdata/org.example.Test.xml")
+	if err != nil {
+		return err
+	}
+	input, err := parser.Parse(b)
+	if err != nil {
+		return err
+	}
+	served, err := parser.ParseNode(node)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(served[len(served)-1], input[0]) {
+		return fmt.Errorf("introspected %s interface doesn't match the input", InterfaceOrg_Example_Test)
+	}
+
+	if node, err = introspect.Call(client.Object(serviceName, root)); err != nil {
+		return err
+	}
+	if len(node.Children) != 1 || node.Children[0].Name != "Test1" {
+		return fmt.Errorf("introspected children = %v, want [Test1]", node.Children)
+	}
+	return nil
+}
+
+func testObjectManager(ctx context.Context, server, client *dbus.Conn, o *Org_Example_Test) error {
+	objects, err := GetManagedObjects(ctx, client, serviceName, root)
+	if err != nil {
+		return err
+	}
+	if len(objects) != 1 || objects[path1] == nil {
+		return fmt.Errorf("managed objects = %v, want %s only", objects, path1)
+	}
+	obj := objects[path1]
+	if obj.Path != path1 || !reflect.DeepEqual(obj.Interfaces, []string{InterfaceOrg_Example_Test}) ||
+		!obj.Implements(InterfaceOrg_Example_Test) || obj.Implements("org.example.Missing") {
+		return fmt.Errorf("managed object %s implements %v", obj.Path, obj.Interfaces)
+	}
+	// proxies are bound to the managed object
+	if obj.Org_Example_Test == nil || obj.Org_Freedesktop_DBus_ObjectManager != nil {
+		return fmt.Errorf("managed object %s proxies are %+v", obj.Path, obj)
+	}
+	if out, err := obj.Org_Example_Test.Echo(ctx, "managed"); err != nil || out != "managed" {
+		return fmt.Errorf("managed object Echo = %q, %v, want %q", out, err, "managed")
+	}
+
+	cache, err := NewObjectCache(ctx, client, serviceName, root)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	obj, ok := cache.Object(path1)
+	if !ok || obj.Org_Example_Test_Snapshot == nil {
+		return fmt.Errorf("object %s is not cached", path1)
+	}
+	if obj.Org_Example_Test_Snapshot.Name != "test" {
+		return fmt.Errorf("cached Name = %q, want %q", obj.Org_Example_Test_Snapshot.Name, "test")
+	}
+
+	if err = ExportOrg_Example_Test(server, path2, &testServer{}); err != nil {
+		return err
+	}
+	if err = waitFor(ctx, func() bool {
+		_, ok := cache.Object(path2)
+		return ok
+	}); err != nil {
+		return fmt.Errorf("object %s is not added: %w", path2, err)
+	}
+
+	if err = UnexportOrg_Example_Test(server, path2); err != nil {
+		return err
+	}
+	if err = waitFor(ctx, func() bool {
+		_, ok := cache.Object(path2)
+		return !ok
+	}); err != nil {
+		return fmt.Errorf("object %s is not removed: %w", path2, err)
+	}
+
+	// properties of unexported objects are not served anymore
+	err = client.Object(serviceName, path2).CallWithContext(ctx,
+		"org.freedesktop.DBus.Properties.Get", 0, InterfaceOrg_Example_Test, "Name").Err
+	if err = expectError(err, "org.freedesktop.DBus.Error.UnknownInterface", ""); err != nil {
+		return fmt.Errorf("Get on %s: %w", path2, err)
+	}
+	return nil
+}
+
+func testExports(ctx context.Context, server, client *dbus.Conn, o *Org_Example_Test) error {
+	// nothing is kept once all exported objects are unexported
+	if err := UnexportOrg_Example_Test(server, path1); err != nil {
+		return err
+	}
+	if err := StopObjectManager(server, root); err != nil {
+		return err
+	}
+	if !exportsEmpty() {
+		return errors.New("exports aren't released after unexporting")
+	}
+
+	// or once the connection is closed
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = ServeObjectManager(conn, root); err != nil {
+		return err
+	}
+	if err = ExportOrg_Example_Test(conn, path1, &testServer{}); err != nil {
+		return err
+	}
+	if exportsEmpty() {
+		return errors.New("exports are empty")
+	}
+	if err = conn.Close(); err != nil {
+		return err
+	}
+	if err = waitFor(ctx, exportsEmpty); err != nil {
+		return fmt.Errorf("exports aren't released after closing the connection: %w", err)
+	}
+	return nil
+}
+
+func exportsEmpty() bool {
+	exports.Lock()
+	defer exports.Unlock()
+	return len(exports.objects) == 0 && len(exports.managers) == 0 && len(exports.conns) == 0
+}
+
+func receiveChanges(ctx context.Context, c <-chan *Org_Example_Test_PropertyChanges) (*Org_Example_Test_PropertyChanges, error) {
+	select {
+	case v, ok := <-c:
+		if !ok {
+			return nil, errors.New("channel closed")
+		}
+		return v, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func receiveTick(ctx context.Context, c <-chan *Org_Example_Test_TickSignal) (*Org_Example_Test_TickSignal, error) {
+	select {
+	case v, ok := <-c:
+		if !ok {
+			return nil, errors.New("channel closed")
+		}
+		return v, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func waitFor(ctx context.Context, cond func() bool) error {
+	for !cond() {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, fn := range []func(ctx context.Context) error{
+		testFuncs,
+		testZeroValues,
+		testCalls,
+		testSignals,
+	} {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sumAll is code under test depending on the client interface.
+func sumAll(ctx context.Context, c Org_Example_Test_Client, values []int32) (int64, error) {
+	sum, _, err := c.Sum(ctx, values)
+	return sum, err
+}
+
+func testFuncs(ctx context.Context) error {
+	errFailed := errors.New("failed")
+	f := &FakeOrg_Example_Test{
+		SumFunc: func(ctx context.Context, values []int32) (int64, uint32, error) {
+			var sum int64
+			for _, v := range values {
+				sum += int64(v)
+			}
+			return sum, uint32(len(values)), nil
+		},
+		FailFunc: func(ctx context.Context, name, message string) error {
+			return errFailed
+		},
+		GetNameFunc: func(ctx context.Context) (string, error) {
+			return "fake", nil
+		},
+		GetCurrentFunc: func(ctx context.Context) (Entry, error) {
+			return Entry{Level: 1, Flags: 2}, nil
+		},
+	}
+
+	sum, err := sumAll(ctx, f, []int32{1, 2, 3})
+	if err != nil {
+		return err
+	}
+	if sum != 6 {
+		return fmt.Errorf("Sum = %d, want 6", sum)
+	}
+	if err = f.Fail(ctx, "a", "b"); err != errFailed {
+		return fmt.Errorf("Fail error = %v, want %v", err, errFailed)
+	}
+
+	// collected from getter Func fields
+	p, err := f.GetAllProperties(ctx)
+	if err != nil {
+		return err
+	}
+	if want := (Org_Example_Test_Snapshot{Name: "fake", Current: Entry{Level: 1, Flags: 2}}); *p != want {
+		return fmt.Errorf("GetAllProperties = %+v, want %+v", *p, want)
+	}
+
+	f.GetAllPropertiesFunc = func(ctx context.Context) (*Org_Example_Test_Snapshot, error) {
+		return &Org_Example_Test_Snapshot{Level: 3}, nil
+	}
+	if p, err = f.GetAllProperties(ctx); err != nil {
+		return err
+	}
+	if p.Level != 3 || p.Name != "" {
+		return fmt.Errorf("GetAllProperties = %+v, want Level = 3 only", *p)
+	}
+	return nil
+}
+
+func testZeroValues(ctx context.Context) error {
+	var f FakeOrg_Example_Test
+	out, err := f.Echo(ctx, "hello")
+	if out != "" || err != nil {
+		return fmt.Errorf("Echo = %q, %v, want zero values", out, err)
+	}
+	entry, err := f.Lookup(ctx, map[string]Entry{"a": {Level: 1}}, "a")
+	if entry != (Entry{}) || err != nil {
+		return fmt.Errorf("Lookup = %+v, %v, want zero values", entry, err)
+	}
+	if err = f.SetLevel(ctx, 1); err != nil {
+		return fmt.Errorf("SetLevel error = %v, want nil", err)
+	}
+	p, err := f.GetAllProperties(ctx)
+	if err != nil {
+		return err
+	}
+	if *p != (Org_Example_Test_Snapshot{}) {
+		return fmt.Errorf("GetAllProperties = %+v, want zero value", *p)
+	}
+	return nil
+}
+
+func testCalls(ctx context.Context) error {
+	var f FakeOrg_Example_Test
+	if _, err := f.Echo(ctx, "hello"); err != nil {
+		return err
+	}
+	if err := f.SetLevel(ctx, 5); err != nil {
+		return err
+	}
+	if _, err := f.GetName(ctx); err != nil {
+		return err
+	}
+	want := []FakeCall{
+		{Method: "Echo", Args: []interface{}{"hello"}},
+		{Method: "SetLevel", Args: []interface{}{int32(5)}},
+		{Method: "GetName", Args: nil},
+	}
+	if calls := f.Calls(); !reflect.DeepEqual(calls, want) {
+		return fmt.Errorf("Calls = %+v, want %+v", calls, want)
+	}
+	return nil
+}
+
+func testSignals(ctx context.Context) error {
+	var f FakeOrg_Example_Test
+	ctx1, cancel1 := context.WithCancel(ctx)
+	defer cancel1()
+	ticks1, err := f.WatchTick(ctx1, nil)
+	if err != nil {
+		return err
+	}
+	ctx2, cancel2 := context.WithCancel(ctx)
+	defer cancel2()
+	ticks2, err := f.WatchTick(ctx2, nil)
+	if err != nil {
+		return err
+	}
+
+	// emitting blocks until all watchers receive the signal
+	errc := make(chan error, 1)
+	go func() {
+		for _, c := range []<-chan *Org_Example_Test_TickSignal{ticks1, ticks2} {
+			s, err := receiveTick(ctx, c)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if s.Body.N != 1 {
+				errc <- fmt.Errorf("Tick body = %+v, want N = 1", s.Body)
+				return
+			}
+		}
+		errc <- nil
+	}()
+	f.EmitTick(&Org_Example_Test_TickSignal{Body: &Org_Example_Test_TickSignalBody{N: 1}})
+	if err = <-errc; err != nil {
+		return err
+	}
+
+	// receivers may subscribe while a signal is being emitted
+	go func() {
+		if _, err := receiveTick(ctx, ticks1); err != nil {
+			errc <- err
+			return
+		}
+		ctx3, cancel3 := context.WithCancel(ctx)
+		defer cancel3()
+		if _, err := f.WatchTick(ctx3, nil); err != nil {
+			errc <- err
+			return
+		}
+		_, err := receiveTick(ctx, ticks2)
+		errc <- err
+	}()
+	f.EmitTick(&Org_Example_Test_TickSignal{Body: &Org_Example_Test_TickSignalBody{N: 2}})
+	if err = <-errc; err != nil {
+		return err
+	}
+
+	// cancelled watchers are unsubscribed and their channels closed,
+	// they don't block emitting signals to the remaining ones
+	cancel1()
+	for range ticks1 {
+	}
+	go f.EmitTick(&Org_Example_Test_TickSignal{Body: &Org_Example_Test_TickSignalBody{N: 3}})
+	s, err := receiveTick(ctx, ticks2)
+	if err != nil {
+		return err
+	}
+	if s.Body.N != 3 {
+		return fmt.Errorf("Tick body = %+v, want N = 3", s.Body)
+	}
+	cancel2()
+	if _, ok := <-ticks2; ok {
+		return errors.New("channel is not closed after cancellation")
+	}
+	return nil
+}
+
+func receiveTick(ctx context.Context, c <-chan *Org_Example_Test_TickSignal) (*Org_Example_Test_TickSignal, error) {
+	select {
+	case v, ok := <-c:
+		if !ok {
+			return nil, errors.New("channel closed")
+		}
+		return v, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+type testServer struct {
+	UnimplementedOrg_Example_Test
+}
+
+// Echo returns the caller's unique name along with the called member.
+func (s *testServer) Echo(ctx context.Context, in string) (string, *dbus.Error) {
+	info, ok := CallInfoFromContext(ctx)
+	if !ok {
+		return "", dbus.MakeFailedError(errors.New("no call info"))
+	}
+	return info.Sender + " " + info.Interface + "." + info.Member + " " + string(info.Path), nil
+}
+
+// GetName returns the caller's unique name when properties are requested
+// by a client and "export" when they're announced by the object manager.
+func (s *testServer) GetName(ctx context.Context) (string, *dbus.Error) {
+	info, ok := CallInfoFromContext(ctx)
+	if !ok {
+		return "export", nil
+	}
+	return info.Sender, nil
+}
+
+func (s *testServer) SetLevel(ctx context.Context, level int32) *dbus.Error {
+	info, ok := CallInfoFromContext(ctx)
+	if !ok || info.Member != "Set" {
+		return dbus.MakeFailedError(errors.New("no property call info"))
+	}
+	return nil
+}
+
+func run() error {
+	server, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	client, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = ExportOrg_Example_Test(server, "/org/example/Test1", &testServer{}); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	sender := client.Names()[0]
+	o := NewOrg_Example_Test(client.Object(server.Names()[0], "/org/example/Test1"))
+
+	out, err := o.Echo(ctx, "")
+	if err != nil {
+		return err
+	}
+	if want := sender + " org.example.Test.Echo /org/example/Test1"; out != want {
+		return fmt.Errorf("Echo = %q, want %q", out, want)
+	}
+
+	name, err := o.GetName(ctx)
+	if err != nil {
+		return err
+	}
+	if name != sender {
+		return fmt.Errorf("GetName = %q, want %q", name, sender)
+	}
+	return o.SetLevel(ctx, 1)
+}
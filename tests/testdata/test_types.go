@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// generated with -type flags mapping Echo arguments to net.IP, the x
+// signature to time.Duration, (iu) to image.Point, the Level property
+// to level and the Tick signal's n argument to count.
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+type level int
+
+func levelFromInt32(v int32) (level, error) {
+	if v < 0 {
+		return 0, errors.New("negative level")
+	}
+	return level(v), nil
+}
+
+func levelToInt32(l level) int32 {
+	return int32(l)
+}
+
+type count uint
+
+func countFromUint32(v uint32) (count, error) {
+	return count(v), nil
+}
+
+func countToUint32(c count) uint32 {
+	return uint32(c)
+}
+
+func parseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not an IP address", s)
+	}
+	return ip, nil
+}
+
+func formatIP(ip net.IP) string {
+	return ip.String()
+}
+
+func durationFromUsec(v int64) (time.Duration, error) {
+	return time.Duration(v) * time.Microsecond, nil
+}
+
+func durationToUsec(d time.Duration) int64 {
+	return int64(d / time.Microsecond)
+}
+
+func pointFromStruct(v struct {
+	V0 int32
+	V1 uint32
+}) (image.Point, error) {
+	return image.Pt(int(v.V0), int(v.V1)), nil
+}
+
+func pointToStruct(p image.Point) struct {
+	V0 int32
+	V1 uint32
+} {
+	return struct {
+		V0 int32
+		V1 uint32
+	}{int32(p.X), uint32(p.Y)}
+}
+
+type testServer struct {
+	UnimplementedOrg_Example_Test
+	level level
+}
+
+func (s *testServer) Echo(in net.IP) (net.IP, *dbus.Error) {
+	return in.To16(), nil
+}
+
+func (s *testServer) Sum(values []int32) (time.Duration, uint32, *dbus.Error) {
+	var sum time.Duration
+	for _, v := range values {
+		sum += time.Duration(v) * time.Millisecond
+	}
+	return sum, uint32(len(values)), nil
+}
+
+func (s *testServer) Lookup(entries map[string]Entry, key string) (image.Point, *dbus.Error) {
+	entry := entries[key]
+	return image.Pt(int(entry.Level), int(entry.Flags)), nil
+}
+
+func (s *testServer) GetLevel() (level, *dbus.Error) {
+	return s.level, nil
+}
+
+func (s *testServer) SetLevel(l level) *dbus.Error {
+	s.level = l
+	return nil
+}
+
+func (s *testServer) GetCurrent() (image.Point, *dbus.Error) {
+	return image.Pt(int(s.level), 1), nil
+}
+
+func run() error {
+	server, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	client, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	const path = dbus.ObjectPath("/org/example/Test1")
+	if err = ExportOrg_Example_Test(server, path, &testServer{level: 1}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	obj := client.Object(server.Names()[0], path)
+	o := NewOrg_Example_Test(obj)
+	ip, err := o.Echo(ctx, net.IPv4(10, 0, 0, 1))
+	if err != nil {
+		return err
+	}
+	if !ip.Equal(net.IPv4(10, 0, 0, 1)) {
+		return fmt.Errorf("Echo = %v, want 10.0.0.1", ip)
+	}
+	var raw string
+	if err = obj.CallWithContext(ctx, InterfaceOrg_Example_Test+".Echo", 0, "10.0.0.1").Store(&raw); err != nil {
+		return err
+	}
+	if raw != "10.0.0.1" {
+		return fmt.Errorf("raw Echo = %q, want %q", raw, "10.0.0.1")
+	}
+	err = obj.CallWithContext(ctx, InterfaceOrg_Example_Test+".Echo", 0, "bad").Err
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) || dbusErr.Name != "org.freedesktop.DBus.Error.InvalidArgs" {
+		return fmt.Errorf("raw Echo error = %v, want InvalidArgs", err)
+	}
+
+	sum, n, err := o.Sum(ctx, []int32{1, 2, 3})
+	if err != nil {
+		return err
+	}
+	if sum != 6*time.Millisecond || n != 3 {
+		return fmt.Errorf("Sum = %v, %d, want 6ms, 3", sum, n)
+	}
+
+	point, err := o.Lookup(ctx, map[string]Entry{"a": {Level: 2, Flags: 3}}, "a")
+	if err != nil {
+		return err
+	}
+	if point != image.Pt(2, 3) {
+		return fmt.Errorf("Lookup = %v, want (2,3)", point)
+	}
+
+	if err = o.SetLevel(ctx, 5); err != nil {
+		return err
+	}
+	err = obj.CallWithContext(ctx, "org.freedesktop.DBus.Properties.Set", 0,
+		InterfaceOrg_Example_Test, "Level", dbus.MakeVariant(int32(-1))).Err
+	if !errors.As(err, &dbusErr) || dbusErr.Name != "org.freedesktop.DBus.Error.InvalidArgs" {
+		return fmt.Errorf("Set(Level, -1) error = %v, want InvalidArgs", err)
+	}
+	props, err := o.GetAllProperties(ctx)
+	if err != nil {
+		return err
+	}
+	if want := (&Org_Example_Test_Snapshot{Name: "", Level: 5, Current: image.Pt(5, 1)}); !reflect.DeepEqual(props, want) {
+		return fmt.Errorf("GetAllProperties = %+v, want %+v", props, want)
+	}
+
+	ticks, err := WatchOrg_Example_Test_Tick(ctx, client)
+	if err != nil {
+		return err
+	}
+	if err = Emit(server, &Org_Example_Test_TickSignal{
+		Path: path,
+		Body: &Org_Example_Test_TickSignalBody{N: 42, Data: map[string]dbus.Variant{}},
+	}); err != nil {
+		return err
+	}
+	select {
+	case s := <-ticks:
+		if s.Body.N != 42 {
+			return fmt.Errorf("Tick N = %d, want 42", s.Body.N)
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
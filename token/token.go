@@ -14,6 +14,7 @@ type Method struct {
 	Name        string
 	In          []*Arg
 	Out         []*Arg
+	Args        []*Arg // In and Out arguments in the declaration order
 	Annotations []*Annotation
 }
 
@@ -35,8 +36,78 @@ type Signal struct {
 
 // Arg is an argument.
 type Arg struct {
-	Name string
-	Type string
+	Name      string
+	Type      *Type
+	Direction string // "in" or "out" for method arguments
+}
+
+// Kind is a D-Bus type kind.
+type Kind int
+
+// Type kinds, array of dict entries is represented by KindDict.
+const (
+	KindByte Kind = iota + 1
+	KindBoolean
+	KindInt16
+	KindUint16
+	KindInt32
+	KindUint32
+	KindInt64
+	KindUint64
+	KindDouble
+	KindUnixFD
+	KindString
+	KindObjectPath
+	KindSignature
+	KindVariant
+	KindArray
+	KindDict
+	KindStruct
+)
+
+var kindNames = [...]string{
+	KindByte:       "byte",
+	KindBoolean:    "boolean",
+	KindInt16:      "int16",
+	KindUint16:     "uint16",
+	KindInt32:      "int32",
+	KindUint32:     "uint32",
+	KindInt64:      "int64",
+	KindUint64:     "uint64",
+	KindDouble:     "double",
+	KindUnixFD:     "unix_fd",
+	KindString:     "string",
+	KindObjectPath: "object_path",
+	KindSignature:  "signature",
+	KindVariant:    "variant",
+	KindArray:      "array",
+	KindDict:       "dict",
+	KindStruct:     "struct",
+}
+
+func (k Kind) String() string {
+	if k > 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "invalid"
+}
+
+// IsBasic reports whether the kind is a D-Bus basic type.
+func (k Kind) IsBasic() bool {
+	return k >= KindByte && k <= KindSignature
+}
+
+// Type is a node of a D-Bus type tree.
+type Type struct {
+	Kind      Kind
+	Signature string  // D-Bus signature of the type, e.g. "a{sv}"
+	Key       *Type   // dict key type
+	Elem      *Type   // array element or dict value type
+	Fields    []*Type // struct field types
+}
+
+func (t *Type) String() string {
+	return t.Signature
 }
 
 // Annotation is a D-Bus annotation.